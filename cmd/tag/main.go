@@ -1,7 +1,456 @@
-package tag
+package main
 
-import "fmt"
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/RickF71/tag-go/internal/engine"
+	"github.com/RickF71/tag-go/internal/tag"
+)
 
 func main() {
-	fmt.Println("TAG framework: Hello, Asymptotic Geometry!")
+	if len(os.Args) < 2 {
+		fmt.Println("TAG framework: Hello, Asymptotic Geometry!")
+		usage()
+		return
+	}
+	var err error
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "playback":
+		err = playback(args)
+	case "replay":
+		err = replay(args)
+	case "explain":
+		err = explain(args)
+	case "graph":
+		err = graph(args)
+	case "keygen":
+		err = keygen(args)
+	case "sign":
+		err = sign(args)
+	case "verify":
+		err = verify(args)
+	case "record":
+		err = record(args)
+	case "rpc":
+		err = rpc(args)
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tag:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: tag <command> [flags]
+
+commands:
+  playback   drive a simulation from recorded CSV/JSONL telemetry
+  replay     rebuild a simulation from a tagd journal
+  explain    narrate why a run ended the way it did
+  graph      export the causal graph of a receipt log
+  keygen     create an ed25519 signing key pair
+  sign       sign a run summary or checkpoint
+  verify     check a hash-chained receipt log or a signed envelope
+  record     step any engine (tote, core, mech) and record it as JSONL
+  rpc        serve a simulation over JSON-RPC 2.0 on stdin/stdout`)
+}
+
+// playback replays recorded samples and prints the run summary as JSON.
+func playback(args []string) error {
+	fs := flag.NewFlagSet("playback", flag.ExitOnError)
+	in := fs.String("in", "", "recorded samples (.csv or .jsonl)")
+	out := fs.String("receipts", "", "write the receipt log here as JSONL")
+	interval := fs.Duration("interval", time.Second, "data time covered by one step")
+	speed := fs.Float64("speed", 0, "playback speed (1 = real time, 0 = as fast as possible)")
+	tail := fs.Int("tail", 0, "extra steps after the data ends")
+	key := fs.String("sign", "", "sign the summary with this private key")
+	fs.Parse(args)
+	if *in == "" {
+		return fmt.Errorf("playback: -in is required")
+	}
+
+	obs, err := tag.LoadObservations(*in)
+	if err != nil {
+		return err
+	}
+	sim := tag.NewSimulation()
+	rep, err := tag.Playback(sim, obs, tag.PlaybackOptions{Interval: *interval, Speed: *speed, Tail: *tail})
+	if err != nil {
+		return err
+	}
+
+	if *out != "" {
+		if err := writeReceipts(*out, sim.Snapshot().Receipts); err != nil {
+			return err
+		}
+	}
+	if *key != "" {
+		return printSigned(*key, tag.KindSummary, rep)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
+
+// replay rebuilds a run from a journal and prints its final state with a
+// fingerprint of the receipt log, so two replays can be compared bit-for-bit.
+func replay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	in := fs.String("journal", "", "journal written by tagd -journal")
+	out := fs.String("receipts", "", "write the receipt log here as JSONL")
+	upto := fs.Int("upto", 0, "stop after this many commands (0 = all)")
+	save := fs.String("checkpoint", "", "write the final state here as a checkpoint")
+	key := fs.String("sign", "", "sign the checkpoint with this private key")
+	fs.Parse(args)
+	if *in == "" {
+		return fmt.Errorf("replay: -journal is required")
+	}
+
+	f, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	cmds, err := tag.ReadJournal(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if *upto > 0 && *upto < len(cmds) {
+		cmds = cmds[:*upto]
+	}
+	sim, err := tag.Replay(cmds)
+	if err != nil {
+		return err
+	}
+
+	if *save != "" {
+		cp, err := sim.Checkpoint()
+		if err != nil {
+			return err
+		}
+		if *key != "" {
+			err = writeSigned(*save, *key, tag.KindCheckpoint, cp)
+		} else {
+			err = tag.SaveCheckpoint(*save, cp)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	snap := sim.Snapshot()
+	if *out != "" {
+		if err := writeReceipts(*out, snap.Receipts); err != nil {
+			return err
+		}
+	}
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	for _, r := range snap.Receipts {
+		enc.Encode(r)
+	}
+	report := struct {
+		Commands    int              `json:"commands"`
+		State       tag.SimState     `json:"state"`
+		Bubbles     []tag.BubbleInfo `json:"bubbles"`
+		Receipts    int              `json:"receipts"`
+		Fingerprint string           `json:"fingerprint"`
+	}{len(cmds), snap, sim.Bubbles(), len(snap.Receipts), hex.EncodeToString(h.Sum(nil))}
+	report.State.Receipts = nil
+
+	enc = json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+func writeReceipts(path string, rs []tag.Receipt) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, r := range rs {
+		if err := enc.Encode(r); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// explain prints the narrative of a receipt log, or the full report with -json.
+func explain(args []string) error {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	in := fs.String("receipts", "", "receipt log (JSONL)")
+	asJSON := fs.Bool("json", false, "print the structured report")
+	fs.Parse(args)
+	if *in == "" {
+		return fmt.Errorf("explain: -receipts is required")
+	}
+	rs, err := readReceipts(*in)
+	if err != nil {
+		return err
+	}
+	rep := tag.Explain(rs)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rep)
+	}
+	for _, line := range rep.Narrative {
+		fmt.Println(line)
+	}
+	return nil
+}
+
+// graph prints the causal graph of a receipt log as JSON or Graphviz DOT.
+func graph(args []string) error {
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	in := fs.String("receipts", "", "receipt log (JSONL)")
+	id := fs.Uint64("id", 0, "only the causes of this receipt")
+	effects := fs.Bool("effects", false, "with -id, follow effects instead of causes")
+	format := fs.String("format", "json", "json or dot")
+	fs.Parse(args)
+	if *in == "" {
+		return fmt.Errorf("graph: -receipts is required")
+	}
+	rs, err := readReceipts(*in)
+	if err != nil {
+		return err
+	}
+	g := tag.NewCausalGraph(rs)
+	if *id != 0 {
+		if _, ok := g.Receipt(*id); !ok {
+			return fmt.Errorf("graph: receipt %d not in %s", *id, *in)
+		}
+		if *effects {
+			g = g.Effects(*id)
+		} else {
+			g = g.Causes(*id)
+		}
+	}
+	if *format == "dot" {
+		return g.WriteDOT(os.Stdout)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(g)
+}
+
+// keygen writes a key pair for sign and verify.
+func keygen(args []string) error {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	out := fs.String("out", "tag.key", "private key path; the public key goes to <out>.pub")
+	fs.Parse(args)
+	pub, err := tag.GenerateKey(*out)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s and %s.pub\npublic key %s\n", *out, *out, hex.EncodeToString(pub))
+	return nil
+}
+
+// sign wraps a JSON document (a summary or checkpoint) in a signed envelope.
+func sign(args []string) error {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	key := fs.String("key", "", "private key from tag keygen")
+	kind := fs.String("kind", tag.KindSummary, "document kind: summary or checkpoint")
+	in := fs.String("in", "", "document to sign")
+	out := fs.String("out", "", "write the envelope here (default stdout)")
+	fs.Parse(args)
+	if *key == "" || *in == "" {
+		return fmt.Errorf("sign: -key and -in are required")
+	}
+	b, err := os.ReadFile(*in)
+	if err != nil {
+		return err
+	}
+	switch *kind {
+	case tag.KindCheckpoint:
+		if _, err := tag.ReadCheckpoint(bytes.NewReader(b)); err != nil {
+			return err
+		}
+	case tag.KindSummary:
+	default:
+		return fmt.Errorf("sign: unknown kind %q", *kind)
+	}
+	doc := json.RawMessage(bytes.TrimSpace(b))
+	if *out != "" {
+		return writeSigned(*out, *key, *kind, doc)
+	}
+	return printSigned(*key, *kind, doc)
+}
+
+// verify checks either a hash-chained receipt log or a signed envelope.
+func verify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	receipts := fs.String("receipts", "", "hash-chained receipt log (JSONL)")
+	head := fs.String("head", "", "expected chain head (catches receipts cut from the end)")
+	env := fs.String("envelope", "", "signed envelope")
+	pub := fs.String("pub", "", "public key the envelope must be signed with")
+	fs.Parse(args)
+
+	switch {
+	case *receipts != "":
+		rs, err := readReceipts(*receipts)
+		if err != nil {
+			return err
+		}
+		if err := tag.VerifyChain(rs, *head); err != nil {
+			return err
+		}
+		fmt.Printf("ok: %d receipts, chain intact\n", len(rs))
+		return nil
+	case *env != "":
+		b, err := os.ReadFile(*env)
+		if err != nil {
+			return err
+		}
+		var e tag.Envelope
+		if err := json.Unmarshal(b, &e); err != nil {
+			return err
+		}
+		var key ed25519.PublicKey
+		if *pub != "" {
+			if key, err = tag.LoadPublicKey(*pub); err != nil {
+				return err
+			}
+		}
+		if err := e.Verify(key); err != nil {
+			return err
+		}
+		trust := "embedded key (integrity only)"
+		if key != nil {
+			trust = *pub
+		}
+		fmt.Printf("ok: %s signed %s by %s\n", e.Kind, e.Signed.Format(time.RFC3339), trust)
+		return nil
+	}
+	return fmt.Errorf("verify: -receipts or -envelope is required")
+}
+
+func printSigned(keyPath, kind string, v any) error {
+	e, err := signed(keyPath, kind, v)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(e)
+}
+
+func writeSigned(path, keyPath, kind string, v any) error {
+	e, err := signed(keyPath, kind, v)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+func signed(keyPath, kind string, v any) (*tag.Envelope, error) {
+	key, err := tag.LoadPrivateKey(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	return tag.Sign(kind, v, key)
+}
+
+func readReceipts(path string) ([]tag.Receipt, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rs []tag.Receipt
+	dec := json.NewDecoder(f)
+	for {
+		var r tag.Receipt
+		if err := dec.Decode(&r); err == io.EOF {
+			return rs, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: receipt %d: %w", path, len(rs), err)
+		}
+		rs = append(rs, r)
+	}
+}
+
+// record steps an engine offline and writes its snapshots (and frames) as JSONL.
+func record(args []string) error {
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+	kind := fs.String("engine", engine.KindTote, "engine kind: "+strings.Join(engine.Kinds(), ", "))
+	steps := fs.Int("steps", 500, "steps to run")
+	every := fs.Int("every", 10, "record every N steps")
+	frames := fs.Bool("frames", false, "include the drawable frame in each record")
+	settle := fs.Bool("settle", true, "stop early once the engine settles")
+	params := fs.String("params", "", `engine parameters as JSON, e.g. {"rate":0.2}`)
+	out := fs.String("out", "", "write records here instead of stdout")
+	fs.Parse(args)
+
+	e, err := engine.New(*kind)
+	if err != nil {
+		return err
+	}
+	if *params != "" {
+		var p engine.Params
+		if err := json.Unmarshal([]byte(*params), &p); err != nil {
+			return fmt.Errorf("record: -params: %w", err)
+		}
+		if err := e.SetParams(p); err != nil {
+			return err
+		}
+	}
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	rec := engine.NewRecorder(w, *frames)
+	if err := engine.Run(e, rec, *steps, *every, *settle); err != nil {
+		return err
+	}
+	snap := e.Snapshot()
+	fmt.Fprintf(os.Stderr, "%s: %d records, step %d, error %.6f, settled %v\n", *kind, rec.Samples(), snap.Step, snap.Error, snap.Settled)
+	return nil
+}
+
+// rpc serves one simulation over JSON-RPC 2.0, one message per line on
+// stdin and stdout, so editors and scripts can drive it as a subprocess.
+func rpc(args []string) error {
+	fs := flag.NewFlagSet("rpc", flag.ExitOnError)
+	restore := fs.String("restore", "", "start from this checkpoint file")
+	fs.Parse(args)
+
+	sim := tag.NewSimulation()
+	if *restore != "" {
+		cp, err := tag.LoadCheckpoint(*restore)
+		if err != nil {
+			return err
+		}
+		if sim, err = tag.FromCheckpoint(cp); err != nil {
+			return err
+		}
+	}
+	defer sim.Clock().Close()
+	return tag.NewRPC(sim).Serve(context.Background(), os.Stdin, os.Stdout)
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/RickF71/tag-go/internal/engine"
+	"github.com/RickF71/tag-go/internal/tag"
+)
+
+// Config is everything tagd can be told. A -config file sets any subset as
+// JSON using the same names as the flags; flags given on the command line
+// win over the file.
+type Config struct {
+	Listen    string `json:"listen"`
+	DataDir   string `json:"data"`     // holds the journal unless -journal says otherwise
+	Journal   string `json:"journal"`  // relative paths are under DataDir
+	Restore   string `json:"restore"`  // checkpoint to start from
+	Scenario  string `json:"scenario"` // tag.Scenario JSON to start from
+	HashChain bool   `json:"hashchain"`
+	Auth      string `json:"auth"`       // tag.AuthConfig token file
+	WSOrigins string `json:"ws_origins"` // comma-separated; see tag.WSOrigins
+	Web       string `json:"web"`        // serve pages from this directory instead of the embedded ones
+	Engine    string `json:"engine"`
+
+	PhysicsHz float64 `json:"physics_hz"`
+	SendHz    float64 `json:"send_hz"`
+
+	MaxSims    int      `json:"max_sims"`
+	MaxRunning int      `json:"max_running"`
+	MaxForks   int      `json:"max_forks"`
+	IdleEvict  Duration `json:"idle_evict"`
+
+	JournalSync     Duration `json:"journal_sync"` // longest a command waits for fsync; 0 syncs each
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+	LogFormat       string   `json:"log_format"`
+	LogLevel        string   `json:"log_level"`
+}
+
+func defaultConfig() Config {
+	return Config{
+		Listen:          ":8080",
+		JournalSync:     Duration(tag.DefaultJournalSync),
+		Engine:          engine.KindTote,
+		PhysicsHz:       tag.DefaultClockRates.PhysicsHz,
+		SendHz:          tag.DefaultClockRates.SendHz,
+		MaxSims:         32,
+		MaxRunning:      8,
+		MaxForks:        tag.ForkLimits.MaxSims,
+		IdleEvict:       Duration(30 * time.Minute),
+		ShutdownTimeout: Duration(10 * time.Second),
+		LogFormat:       "text",
+		LogLevel:        "info",
+	}
+}
+
+// Duration is a time.Duration written as "30m" in flags and config files.
+type Duration time.Duration
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+func (d *Duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	*d = Duration(v)
+	return err
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30m\"")
+	}
+	return d.Set(s)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) { return json.Marshal(d.String()) }
+
+// flags binds a fresh flag set to c.
+func (c *Config) flags() *flag.FlagSet {
+	fs := flag.NewFlagSet("tagd", flag.ContinueOnError)
+	fs.String("config", "", "read settings from this JSON file; flags override it")
+	fs.StringVar(&c.Listen, "listen", c.Listen, "address to serve on")
+	fs.StringVar(&c.DataDir, "data", c.DataDir, "data directory; the journal defaults to journal.jsonl in it")
+	fs.StringVar(&c.Journal, "journal", c.Journal, "record commands to this file and resume from it on start")
+	fs.Var(&c.JournalSync, "journal-sync", "fsync journaled commands at most this long after writing them (0 = before each command is applied, <0 = leave it to the OS)")
+	fs.StringVar(&c.Restore, "restore", c.Restore, "start from this checkpoint file")
+	fs.StringVar(&c.Scenario, "scenario", c.Scenario, "start from this scenario file (tag.Scenario JSON)")
+	fs.BoolVar(&c.HashChain, "hashchain", c.HashChain, "hash-chain receipts so exported logs are tamper-evident")
+	fs.StringVar(&c.Auth, "auth", c.Auth, "token file enabling read/control roles on the API (see tag.AuthConfig)")
+	fs.StringVar(&c.WSOrigins, "ws-origins", c.WSOrigins, "comma-separated browser origins, besides this server's, that may open WebSockets (* = any)")
+	fs.StringVar(&c.Web, "web", c.Web, "serve the observatory from this directory instead of the built-in copy")
+	fs.StringVar(&c.Engine, "engine", c.Engine, "model served under /api/engine: "+strings.Join(engine.Kinds(), ", "))
+	fs.Float64Var(&c.PhysicsHz, "physics-hz", c.PhysicsHz, "simulation steps per second at speed 1")
+	fs.Float64Var(&c.SendHz, "send-hz", c.SendHz, "stream updates per second")
+	fs.IntVar(&c.MaxSims, "max-sims", c.MaxSims, "simulations hosted under /api/sims at once (0 = unlimited)")
+	fs.IntVar(&c.MaxRunning, "max-running", c.MaxRunning, "hosted simulations whose clocks may run at once (0 = unlimited)")
+	fs.IntVar(&c.MaxForks, "max-forks", c.MaxForks, "forks kept per simulation, forks of forks included (0 = unlimited)")
+	fs.Var(&c.IdleEvict, "idle-evict", "drop hosted simulations and forks unused for this long (0 = never)")
+	fs.Var(&c.ShutdownTimeout, "shutdown-timeout", "how long to wait for requests to finish on shutdown")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "log format: text or json")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "log level: debug, info, warn or error")
+	return fs
+}
+
+// loadConfig applies the defaults, then the -config file, then the flags.
+func loadConfig(args []string, stderr io.Writer) (Config, error) {
+	c := defaultConfig()
+	fs := c.flags()
+	fs.SetOutput(stderr)
+	if err := fs.Parse(args); err != nil {
+		return c, err
+	}
+	if path := fs.Lookup("config").Value.String(); path != "" {
+		c = defaultConfig()
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return c, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&c); err != nil {
+			return c, fmt.Errorf("config %s: %w", path, err)
+		}
+		fs = c.flags()
+		fs.SetOutput(stderr)
+		fs.Parse(args) // parsed cleanly once already
+	}
+	return c, c.check()
+}
+
+func (c *Config) check() error {
+	if c.Restore != "" && c.Scenario != "" {
+		return fmt.Errorf("-restore and -scenario both choose the starting state")
+	}
+	switch c.LogFormat {
+	case "text", "json":
+	default:
+		return fmt.Errorf("-log-format: want text or json, got %q", c.LogFormat)
+	}
+	if c.DataDir != "" && c.Journal == "" {
+		c.Journal = "journal.jsonl"
+	}
+	if c.DataDir != "" && c.Journal != "" && !filepath.IsAbs(c.Journal) {
+		c.Journal = filepath.Join(c.DataDir, c.Journal)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/RickF71/tag-go/internal/tag"
+)
+
+// newLogger builds the process logger from -log-format and -log-level.
+func newLogger(c Config) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	if c.LogFormat == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+}
+
+// --- requests ---
+
+// logRequests logs every request once it has been answered. Streams and
+// WebSockets are logged when they end.
+func logRequests(log *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		lw := &logWriter{ResponseWriter: w}
+		next.ServeHTTP(lw, r)
+		status := lw.status
+		switch {
+		case lw.hijacked:
+			status = http.StatusSwitchingProtocols
+		case status == 0:
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		log.LogAttrs(r.Context(), level, "request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int64("bytes", lw.bytes),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote", r.RemoteAddr))
+	})
+}
+
+// logWriter counts what a handler writes. It passes Flush and Hijack
+// through because the stream and WebSocket handlers need them.
+type logWriter struct {
+	http.ResponseWriter
+	status   int
+	bytes    int64
+	hijacked bool
+}
+
+func (w *logWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *logWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *logWriter) Flush() {
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *logWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, brw, err
+}
+
+func (w *logWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// --- simulation events ---
+
+// notable receipts are logged at info; the rest only at debug.
+var notable = map[tag.ReceiptType]bool{
+	tag.RSpawnChain: true,
+	tag.RMetaBirth:  true,
+	tag.RReconcile:  true,
+	tag.RTopology:   true,
+	tag.RParams:     true,
+	tag.RAudit:      true,
+}
+
+// logReceipts logs the main simulation's receipts until cancel is called. If
+// the log falls 256 receipts behind, the receipts that do not fit are counted
+// instead of logged.
+func logReceipts(log *slog.Logger, sim *tag.Simulation) (cancel func()) {
+	return sim.OnReceipt(func(r tag.Receipt) {
+		level := slog.LevelDebug
+		if notable[r.Type] {
+			level = slog.LevelInfo
+		}
+		log.Log(context.Background(), level, "receipt",
+			"id", r.ID, "step", r.Step, "type", string(r.Type), "subject", r.Subject, "note", r.Note)
+	}, tag.Buffered(256), tag.OnDrop(func(n int) {
+		log.Warn("receipt log fell behind; receipts not logged", "dropped", n)
+	}))
+}
@@ -1,21 +1,239 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/RickF71/tag-go/internal/engine"
 	"github.com/RickF71/tag-go/internal/tag"
+	"github.com/RickF71/tag-go/web"
 )
 
 func main() {
-	sim := tag.NewSimulation()
+	cfg, err := loadConfig(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tagd:", err)
+		os.Exit(2)
+	}
+	log, err := newLogger(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tagd: -log-level:", err)
+		os.Exit(2)
+	}
+	slog.SetDefault(log)
+	if err := run(cfg, log); err != nil {
+		log.Error("tagd stopped", "err", err)
+		os.Exit(1)
+	}
+}
+
+// run serves until SIGINT or SIGTERM, then shuts down in order: stop taking
+// requests and end streams, stop the clocks, then flush the journal.
+func run(cfg Config, log *slog.Logger) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.DataDir != "" {
+		if err := os.MkdirAll(cfg.DataDir, 0o755); err != nil {
+			return err
+		}
+	}
+	sim, journal, err := openSim(cfg, log)
+	if err != nil {
+		if journal != nil {
+			journal.Close()
+		}
+		return err
+	}
+	defer func() {
+		if journal == nil {
+			return
+		}
+		sim.SetJournal(nil)
+		if err := journal.Close(); err != nil {
+			log.Error("journal close", "path", journal.Path(), "err", err)
+			return
+		}
+		log.Info("journal flushed", "path", journal.Path())
+	}()
+	defer sim.Clock().Close()
+	defer logReceipts(log, sim)()
+
+	rates := tag.ClockRates{PhysicsHz: cfg.PhysicsHz, SendHz: cfg.SendHz}
+	if err := sim.Clock().SetRates(rates); err != nil {
+		return err
+	}
+
+	tag.ForkLimits = tag.HostLimits{MaxSims: cfg.MaxForks, MaxRunning: cfg.MaxRunning, IdleAfter: time.Duration(cfg.IdleEvict), Rates: rates}
+	for _, o := range strings.Split(cfg.WSOrigins, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			tag.WSOrigins = append(tag.WSOrigins, o)
+		}
+	}
+
 	mux := http.NewServeMux()
 	tag.RegisterRoutes(mux, sim)
+	host := tag.NewHost(tag.HostLimits{MaxSims: cfg.MaxSims, MaxRunning: cfg.MaxRunning, IdleAfter: time.Duration(cfg.IdleEvict), Rates: rates})
+	defer host.Close()
+	host.Register(mux, sim)
+	tag.RegisterV1(mux)
+
+	// /api/engine serves the main simulation, or a separate model of another kind
+	var e engine.Engine = engine.NewTote(sim)
+	if cfg.Engine != engine.KindTote {
+		if e, err = engine.New(cfg.Engine); err != nil {
+			return err
+		}
+	}
+	clock := engine.Register(mux, "/api/engine", e)
+	defer clock.Close()
+	if err := clock.SetRates(rates); err != nil {
+		return err
+	}
+
+	// the observatory is built in; -web serves a working copy instead
+	pages := http.FS(web.Files)
+	if cfg.Web != "" {
+		pages = http.Dir(cfg.Web)
+	}
+	mux.Handle("/", http.FileServer(pages))
 
-	// Serve static files from the web/ directory.
-	fs := http.FileServer(http.Dir("web"))
-	mux.Handle("/", fs)
+	var handler http.Handler = mux
+	if cfg.Auth != "" {
+		auth, err := tag.LoadAuth(cfg.Auth)
+		if err != nil {
+			return err
+		}
+		handler = auth.Middleware(mux)
+		log.Info("auth enabled", "file", cfg.Auth)
+	}
+
+	// streams run on base, so cancelling it ends them before Shutdown waits
+	base, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           logRequests(log, handler),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return base },
+		ErrorLog:          slog.NewLogLogger(log.Handler(), slog.LevelWarn),
+	}
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return err
+	}
+	log.Info("TAG Observatory live", "url", "http://"+displayAddr(ln.Addr())+"/observatory.html")
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(ln) }()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+	log.Info("shutting down", "timeout", cfg.ShutdownTimeout)
+	cancel()
+	sctx, done := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout))
+	defer done()
+	if err := srv.Shutdown(sctx); err != nil {
+		log.Warn("requests still open at shutdown timeout", "err", err)
+		srv.Close()
+	}
+	return nil
+}
+
+// openSim builds the main simulation from the journal, a checkpoint or a
+// scenario. Whatever it starts from is recorded in a fresh journal.
+func openSim(cfg Config, log *slog.Logger) (*tag.Simulation, *tag.Journal, error) {
+	sim := tag.NewSimulation()
+	var j *tag.Journal
+	resumed := false
+	if cfg.Journal != "" {
+		var cmds []tag.Command
+		var err error
+		if j, cmds, err = tag.OpenJournal(cfg.Journal); err != nil {
+			return nil, nil, err
+		}
+		if sim, err = tag.Replay(cmds); err != nil {
+			return nil, j, err
+		}
+		j.SyncEvery(time.Duration(cfg.JournalSync))
+		j.OnError(func(err error) {
+			log.Error("journal write failed; the simulation no longer changes", "path", cfg.Journal, "err", err)
+		})
+		sim.SetJournal(j)
+		resumed = len(cmds) > 0
+		if n := j.Torn(); n > 0 {
+			log.Warn("journal ended in an unfinished command; dropped it", "path", cfg.Journal, "bytes", n)
+		}
+		log.Info("journal resumed", "path", cfg.Journal, "commands", len(cmds), "step", sim.StepNum)
+	}
+
+	var cp *tag.Checkpoint
+	switch {
+	case cfg.Restore != "":
+		var err error
+		if cp, err = tag.LoadCheckpoint(cfg.Restore); err != nil {
+			return nil, j, err
+		}
+	case cfg.Scenario != "":
+		b, err := os.ReadFile(cfg.Scenario)
+		if err != nil {
+			return nil, j, err
+		}
+		var sc tag.Scenario
+		if err := json.Unmarshal(b, &sc); err != nil {
+			return nil, j, fmt.Errorf("scenario %s: %w", cfg.Scenario, err)
+		}
+		built, err := sc.Build()
+		if err != nil {
+			return nil, j, fmt.Errorf("scenario %s: %w", cfg.Scenario, err)
+		}
+		if cp, err = built.Checkpoint(); err != nil {
+			return nil, j, err
+		}
+	}
+	if cp != nil {
+		if resumed {
+			return nil, j, fmt.Errorf("journal %s already holds a run; -restore and -scenario need a fresh one", cfg.Journal)
+		}
+		if err := sim.Restore(cp); err != nil {
+			return nil, j, err
+		}
+		log.Info("starting state loaded", "restore", cfg.Restore, "scenario", cfg.Scenario, "step", cp.Step)
+	}
+
+	if cfg.HashChain {
+		if on, _ := sim.HashChain(); !on {
+			sim.SetHashChain(true)
+		}
+	}
+	return sim, j, nil
+}
 
-	fmt.Println("TAG Observatory live at http://localhost:8080/observatory.html")
-	http.ListenAndServe(":8080", mux)
+// displayAddr turns a wildcard listen address into one a browser can open.
+func displayAddr(a net.Addr) string {
+	host, port, err := net.SplitHostPort(a.String())
+	if err != nil {
+		return a.String()
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
 }
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/RickF71/tag-go/internal/tag"
+	client "github.com/RickF71/tag-go/pkg/tag"
+)
+
+// Drives an in-process tagd through the Go client: stepping, params,
+// topology, receipts, checkpoints, hosted sims and a stream that survives
+// its connection being cut. Exits non-zero on the first mismatch.
+func main() {
+	sim := tag.NewSimulation()
+	mux := http.NewServeMux()
+	tag.RegisterRoutes(mux, sim)
+	host := tag.NewHost(tag.HostLimits{})
+	defer host.Close()
+	host.Register(mux, sim)
+	tag.RegisterV1(mux)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := client.NewClient(srv.URL)
+	check := func(what string, err error) {
+		if err != nil {
+			log.Fatalf("%s: %v", what, err)
+		}
+		fmt.Println("ok  ", what)
+	}
+
+	st, err := c.Step(ctx)
+	if err == nil && (st.Step != 1 || st.Schema != client.SchemaVersion) {
+		err = fmt.Errorf("got step %d schema %d", st.Step, st.Schema)
+	}
+	check("step", err)
+
+	_, err = c.Run(ctx, client.RunRequest{Steps: 20})
+	check("run", err)
+
+	v := 0.5
+	p, err := c.SetParams(ctx, client.ParamsPatch{Viscosity: &v})
+	if err == nil && p.Viscosity != v {
+		err = fmt.Errorf("viscosity %v", p.Viscosity)
+	}
+	check("set params", err)
+
+	bad := -1.0
+	_, err = c.SetParams(ctx, client.ParamsPatch{Limit: &bad})
+	var ae *client.APIError
+	if !errors.As(err, &ae) || ae.Code != tag.CodeInvalidParam || ae.Field != "limit" {
+		log.Fatalf("invalid params: want invalid_param on limit, got %v", err)
+	}
+	fmt.Println("ok   invalid params rejected:", ae.Message)
+
+	_, err = c.AddBubble(ctx, client.BubbleSpec{ID: "X", After: "C", State: 1, Demand: 1, Tolerance: 0.1})
+	check("add bubble", err)
+	_, err = c.Bubble(ctx, "nope")
+	if !client.IsNotFound(err) {
+		log.Fatalf("missing bubble: want not found, got %v", err)
+	}
+	check("remove bubble", c.RemoveBubble(ctx, "X"))
+
+	page, err := c.Receipts(ctx, client.ReceiptQuery{Limit: 5})
+	if err == nil && len(page.Receipts) == 0 {
+		err = errors.New("no receipts")
+	}
+	check("receipts", err)
+
+	cp, err := c.Checkpoint(ctx)
+	check("checkpoint", err)
+	c.Run(ctx, client.RunRequest{Steps: 10})
+	st, err = c.Restore(ctx, cp)
+	if err == nil && st.Step != cp.Step {
+		err = fmt.Errorf("restored step %d, want %d", st.Step, cp.Step)
+	}
+	check("restore", err)
+
+	info, err := c.CreateSim(ctx, client.CreateRequest{ID: "scratch"})
+	check("create sim", err)
+	sc := c.Sim(info.ID)
+	st, err = sc.Step(ctx)
+	if err == nil && st.Step != 1 {
+		err = fmt.Errorf("hosted step %d", st.Step)
+	}
+	check("hosted step", err)
+
+	// a stream that loses its connection twice must resume where it left off,
+	// never repeating a frame or a receipt
+	sctx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	go func() { // keep the simulation changing so frames keep coming
+		for sctx.Err() == nil {
+			c.Step(sctx)
+			time.Sleep(50 * time.Millisecond)
+		}
+	}()
+	var cursor, last uint64
+	frames, cuts := 0, 0
+	err = c.Subscribe(sctx, client.StreamOptions{}, func(fr client.StreamFrame) error {
+		if fr.Cursor < cursor {
+			return fmt.Errorf("cursor went back: %d after %d", fr.Cursor, cursor)
+		}
+		cursor = fr.Cursor
+		for _, r := range fr.Receipts {
+			if r.ID <= last {
+				return fmt.Errorf("receipt %d repeated after %d", r.ID, last)
+			}
+			last = r.ID
+		}
+		frames++
+		if frames%5 == 0 && cuts < 2 {
+			cuts++
+			srv.CloseClientConnections()
+		}
+		if frames == 15 {
+			return errDone
+		}
+		return nil
+	})
+	if errors.Is(err, errDone) {
+		err = nil
+	}
+	check(fmt.Sprintf("stream (%d frames, %d reconnects)", frames, cuts), err)
+
+	check("delete sim", c.DeleteSim(ctx, info.ID))
+}
+
+var errDone = errors.New("done")
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/RickF71/tag-go/pkg/tag"
+)
+
+// Posts synthetic service measurements to a running tagd:
+// B's latency wanders around its SLO target, with some samples
+// arriving late and some never arriving at all.
+func main() {
+	addr := flag.String("addr", "http://localhost:8080", "tagd base URL")
+	bubble := flag.String("bubble", "B", "bubble to drive")
+	rate := flag.Duration("every", 100*time.Millisecond, "interval between batches")
+	target := flag.Float64("slo", 1.6, "demand (SLO target)")
+	lateP := flag.Float64("late", 0.05, "probability a sample is sent late")
+	dropP := flag.Float64("drop", 0.05, "probability a sample is never sent")
+	flag.Parse()
+
+	client := tag.NewClient(*addr)
+	var held []tag.Observation
+	start := time.Now()
+
+	for i := 0; ; i++ {
+		now := time.Now()
+		t := now.Sub(start).Seconds()
+		state := *target - 0.3 + 0.25*math.Sin(t/3) + 0.05*rand.NormFloat64()
+		o := tag.Observation{Bubble: *bubble, TS: now, State: &state, Demand: target}
+
+		var batch []tag.Observation
+		switch r := rand.Float64(); {
+		case r < *dropP:
+			// missing sample
+		case r < *dropP+*lateP:
+			held = append(held, o)
+		default:
+			batch = append(batch, o)
+		}
+		if len(held) > 0 && i%10 == 0 {
+			batch = append(batch, held...)
+			held = held[:0]
+		}
+
+		if len(batch) > 0 {
+			if _, err := client.Ingest(context.Background(), batch...); err != nil {
+				fmt.Fprintln(os.Stderr, "ingest:", err)
+			}
+		}
+		time.Sleep(*rate)
+	}
+}
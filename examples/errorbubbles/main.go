@@ -10,6 +10,7 @@ import (
 func main() {
 	http.HandleFunc("/", servePage)
 	http.HandleFunc("/stream", handleStream)
+	http.HandleFunc("/api/tag/params", handleParams)
 
 	go RunLoop(func(f tag.Frame) { mu.Lock(); latest = f; mu.Unlock() })
 
@@ -27,6 +27,10 @@ func handleParams(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), 400)
 			return
 		}
+		if err := sim.SetParams(tag.ParamsPatch{Viscosity: &p.Viscosity, Limit: &p.Limit, Dt: &p.Dt}); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
 		mu.Lock()
 		params = p
 		mu.Unlock()
@@ -45,6 +49,7 @@ func handleParams(w http.ResponseWriter, r *http.Request) {
 func Serve() {
 	http.HandleFunc("/", servePage)
 	http.HandleFunc("/stream", handleStream)
+	http.HandleFunc("/api/tag/params", handleParams)
 	go RunLoop(func(f tag.Frame) { latest = f })
 	fmt.Println("Demo running at http://localhost:8080")
 	http.ListenAndServe(":8080", nil)
@@ -79,5 +84,5 @@ func handleStream(w http.ResponseWriter, r *http.Request) {
 }
 
 func servePage(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, "examples/mechchain/view.html")
+	http.ServeFile(w, r, "examples/errorbubbles/observatory.html")
 }
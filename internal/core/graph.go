@@ -0,0 +1,67 @@
+// graph.go: chains of nodes for TAG core
+package core
+
+import "fmt"
+
+// Graph is a chain of nodes in sequence: each node's Function is its
+// upstream node's current Constraint, so a disturbance at the top
+// propagates down as every node rebalances.
+type Graph struct {
+	Nodes []*Node
+	Rate  float64 // rebalancing rate passed to Node.Step
+	Steps int
+}
+
+// NewGraph links nodes top to bottom.
+func NewGraph(rate float64, nodes ...*Node) *Graph {
+	g := &Graph{Nodes: nodes, Rate: rate}
+	for i := range nodes {
+		g.propagate(i)
+	}
+	return g
+}
+
+// DefaultGraph returns the three-node chain A→B→C used by the demos.
+func DefaultGraph() *Graph {
+	return NewGraph(0.1,
+		&Node{ID: "A", Function: Vector{X: 1, Y: 1}, Constraint: Vector{X: 0.2, Y: 0.7}, Tolerance: 0.01},
+		&Node{ID: "B", Constraint: Vector{X: 0.2, Y: 0.6}, Tolerance: 0.01},
+		&Node{ID: "C", Constraint: Vector{X: 0.6, Y: 0.2}, Tolerance: 0.01},
+	)
+}
+
+// Step rebalances every node once, top first.
+func (g *Graph) Step() {
+	for i, n := range g.Nodes {
+		g.propagate(i)
+		n.Step(g.Rate)
+	}
+	g.Steps++
+}
+
+// propagate feeds node i its upstream constraint.
+func (g *Graph) propagate(i int) {
+	if i > 0 && i < len(g.Nodes) {
+		g.Nodes[i].Function = g.Nodes[i-1].Constraint
+	}
+}
+
+// Node finds a node by ID.
+func (g *Graph) Node(id string) (*Node, error) {
+	for _, n := range g.Nodes {
+		if n.ID == id {
+			return n, nil
+		}
+	}
+	return nil, fmt.Errorf("node %q not found", id)
+}
+
+// Clear reports whether every node is within its tolerance.
+func (g *Graph) Clear() bool {
+	for _, n := range g.Nodes {
+		if !n.IsClear() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/RickF71/tag-go/internal/tag"
+)
+
+// maxStepsPerRequest bounds POST {prefix}/step?n=.
+const maxStepsPerRequest = 100_000
+
+// model adapts an Engine to tag.Model. Its ticks carry only the step;
+// streams sample the engine themselves.
+type model struct{ Engine }
+
+func (m model) Idle() bool { return m.Snapshot().Settled }
+
+func (m model) Tick() (tag.Event, any) {
+	step := m.Snapshot().Step
+	return tag.Event{ID: step}, step
+}
+
+// ClockOf returns the clock that drives e. The tote engine shares its
+// simulation's, so /api/tag and /api/engine step one physics loop; other
+// engines get a clock of their own.
+func ClockOf(e Engine) *tag.Clock {
+	if c, ok := e.(interface{ Clock() *tag.Clock }); ok {
+		return c.Clock()
+	}
+	return tag.NewClock(model{e})
+}
+
+// Register exposes e under prefix (e.g. "/api/engine"): state, step, reset,
+// params, frame, clock and an SSE stream of Records, one per clock tick. It
+// returns the clock driving the stream; callers close it on shutdown.
+func Register(m *http.ServeMux, prefix string, e Engine) *tag.Clock {
+	clock := ClockOf(e)
+	mux := tag.NewRouter(m)
+	defer mux.Finish()
+
+	mux.HandleFunc("GET "+prefix+"/state", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(e.Snapshot())
+	})
+
+	mux.HandleFunc("POST "+prefix+"/step", func(w http.ResponseWriter, r *http.Request) {
+		n := 1
+		if s := r.URL.Query().Get("n"); s != "" {
+			v, err := strconv.Atoi(s)
+			if err != nil || v < 1 || v > maxStepsPerRequest {
+				tag.WriteError(w, fmt.Errorf("n must be an integer in [1, %d]", maxStepsPerRequest))
+				return
+			}
+			n = v
+		}
+		for i := 0; i < n; i++ {
+			e.Step()
+		}
+		json.NewEncoder(w).Encode(e.Snapshot())
+	})
+
+	mux.HandleFunc("POST "+prefix+"/reset", func(w http.ResponseWriter, r *http.Request) {
+		e.Reset()
+		json.NewEncoder(w).Encode(e.Snapshot())
+	})
+
+	mux.HandleFunc("GET "+prefix+"/params", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(e.Params())
+	})
+
+	setParams := func(w http.ResponseWriter, r *http.Request) {
+		var p Params
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			tag.WriteError(w, tag.BadJSON(err))
+			return
+		}
+		if err := e.SetParams(p); err != nil {
+			tag.WriteError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(e.Params())
+	}
+	mux.HandleFunc("POST "+prefix+"/params", setParams)
+	mux.HandleFunc("PATCH "+prefix+"/params", setParams)
+
+	mux.HandleFunc("GET "+prefix+"/frame", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(e.Frame())
+	})
+
+	mux.HandleFunc("GET "+prefix+"/clock", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(clock.Status())
+	})
+
+	mux.HandleFunc("POST "+prefix+"/clock", func(w http.ResponseWriter, r *http.Request) {
+		var u tag.ClockUpdate
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			tag.WriteError(w, tag.BadJSON(err))
+			return
+		}
+		if err := clock.Update(u); err != nil {
+			tag.WriteError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(clock.Status())
+	})
+
+	mux.HandleFunc("GET "+prefix+"/stream", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			tag.WriteError(w, &tag.APIError{Status: http.StatusInternalServerError, Code: tag.CodeInternal, Message: "streaming unsupported"})
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+
+		last, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+		ticks, cancel := clock.Subscribe(last)
+		defer cancel()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case ev, ok := <-ticks:
+				if !ok {
+					return
+				}
+				// a backlog of ticks needs only one fresh record
+				for len(ticks) > 0 {
+					if ev, ok = <-ticks; !ok {
+						return
+					}
+				}
+				b, _ := json.Marshal(Sample(e, true))
+				fmt.Fprintf(w, "id: %d\ndata: %s\n\n", ev.ID, b)
+				flusher.Flush()
+			}
+		}
+	})
+
+	return clock
+}
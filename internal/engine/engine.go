@@ -0,0 +1,110 @@
+// Package engine puts every model tagd can host behind one interface, so
+// the same HTTP API, stream, recorder and CLI work for tote simulations,
+// core node graphs and the mechanical chain alike.
+package engine
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/RickF71/tag-go/internal/tag"
+)
+
+// Engine kinds.
+const (
+	KindTote = "tote" // tag.Simulation: totebubbles, error chain and meta
+	KindCore = "core" // core.Graph: nodes rebalancing toward equilibrium
+	KindMech = "mech" // mech.Chain: the mass-spring chain
+)
+
+// Engine is a steppable model. Implementations are safe for concurrent use.
+//
+// Frames use the tag.Frame contract: every engine draws its primary parts
+// as "tote" bubbles and its distance from equilibrium as "error" bubbles.
+type Engine interface {
+	Kind() string
+	Step()
+	Reset()
+	Snapshot() Snapshot
+	Params() Params
+	SetParams(Params) error
+	Frame() tag.Frame
+}
+
+// Snapshot is the engine-neutral summary of a model.
+type Snapshot struct {
+	Kind    string             `json:"kind"`
+	Step    int                `json:"step"`
+	Error   float64            `json:"error"`   // total distance from equilibrium
+	Settled bool               `json:"settled"` // stepping would change nothing visible
+	Values  map[string]float64 `json:"values"`  // part ID -> its own error
+}
+
+// Params are an engine's tunable numbers by name. SetParams changes only the
+// names given and rejects names the engine does not have.
+type Params map[string]float64
+
+// New builds an engine of the given kind in its default configuration.
+func New(kind string) (Engine, error) {
+	switch kind {
+	case KindTote:
+		return NewTote(tag.NewSimulation()), nil
+	case KindCore:
+		return NewGraph(nil), nil
+	case KindMech:
+		return NewMech(DefaultMasses), nil
+	}
+	return nil, fmt.Errorf("unknown engine %q (want one of %v)", kind, Kinds())
+}
+
+// Kinds lists the kinds New accepts.
+func Kinds() []string {
+	return []string{KindCore, KindMech, KindTote}
+}
+
+// apply checks p against the names in known and calls set for each entry,
+// in name order. Every value must be finite; engines check their own ranges.
+func apply(p Params, known []string, set func(name string, v float64)) error {
+	names := make([]string, 0, len(p))
+	for name, v := range p {
+		ok := false
+		for _, k := range known {
+			ok = ok || k == name
+		}
+		if !ok {
+			return fmt.Errorf("unknown parameter %q (want one of %v)", name, known)
+		}
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("%s must be finite", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		set(name, p[name])
+	}
+	return nil
+}
+
+// positive rejects zero and negative values, for engines whose parameters
+// are all rates, stiffnesses or tolerances.
+func positive(p Params) error {
+	for name, v := range p {
+		if v <= 0 {
+			return fmt.Errorf("%s must be > 0", name)
+		}
+	}
+	return nil
+}
+
+// line places n parts evenly along y = 0 in the normalised frame.
+func line(n int) [][2]float64 {
+	out := make([][2]float64, n)
+	for i := range out {
+		if n > 1 {
+			out[i][0] = -0.85 + 1.7*float64(i)/float64(n-1)
+		}
+	}
+	return out
+}
@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"math"
+	"sync"
+
+	"github.com/RickF71/tag-go/internal/core"
+	"github.com/RickF71/tag-go/internal/tag"
+)
+
+// Graph adapts a core.Graph. A node's error is how far its constraint is
+// from aligning with its function (1 - cosine).
+type Graph struct {
+	mu    sync.Mutex
+	g     *core.Graph
+	build func() *core.Graph
+}
+
+// NewGraph wraps the graph build returns; Reset calls build again.
+// A nil build uses core.DefaultGraph.
+func NewGraph(build func() *core.Graph) *Graph {
+	if build == nil {
+		build = core.DefaultGraph
+	}
+	return &Graph{g: build(), build: build}
+}
+
+func (e *Graph) Kind() string { return KindCore }
+
+func (e *Graph) Step() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.g.Step()
+}
+
+func (e *Graph) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.g = e.build()
+}
+
+func misalignment(n *core.Node) float64 {
+	return math.Max(0, 1-n.EquilibriumError())
+}
+
+func (e *Graph) Snapshot() Snapshot {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := Snapshot{Kind: KindCore, Step: e.g.Steps, Settled: e.g.Clear(), Values: map[string]float64{}}
+	for _, n := range e.g.Nodes {
+		s.Values[n.ID] = misalignment(n)
+		s.Error += s.Values[n.ID]
+	}
+	return s
+}
+
+func (e *Graph) Params() Params {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	p := Params{"rate": e.g.Rate}
+	for _, n := range e.g.Nodes {
+		p[n.ID+".tolerance"] = n.Tolerance
+	}
+	return p
+}
+
+func (e *Graph) SetParams(p Params) error {
+	if err := positive(p); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	known := []string{"rate"}
+	for _, n := range e.g.Nodes {
+		known = append(known, n.ID+".tolerance")
+	}
+	return apply(p, known, func(name string, v float64) {
+		if name == "rate" {
+			e.g.Rate = v
+			return
+		}
+		for _, n := range e.g.Nodes {
+			if name == n.ID+".tolerance" {
+				n.Tolerance = v
+			}
+		}
+	})
+}
+
+func (e *Graph) Frame() tag.Frame {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	f := tag.Frame{
+		Schema: tag.SchemaVersion, Step: e.g.Steps, Equilibria: map[string]bool{}, ErrScalars: map[string]float64{},
+		Bubbles: []tag.Bubble{}, Links: [][2]string{},
+	}
+	pos := line(len(e.g.Nodes))
+	for i, n := range e.g.Nodes {
+		m := misalignment(n)
+		f.Equilibria[n.ID] = n.IsClear()
+		f.ErrScalars[n.ID] = m
+		f.Bubbles = append(f.Bubbles,
+			tag.Bubble{
+				ID: n.ID, Label: n.ID + ".tote", Kind: "tote", Center: [2]float64{pos[i][0], 0.2},
+				Radius: 0.04 + 0.04*math.Min(1, n.Constraint.Magnitude()), Energy: n.Constraint.Magnitude(), ColorHint: "primary",
+			},
+			tag.Bubble{
+				ID: n.ID, Label: n.ID + ".err", Kind: "error", Center: [2]float64{pos[i][0], -0.2},
+				Radius: 0.01 + 0.06*math.Min(1, m), Excess: m, Energy: m, ColorHint: "error",
+			})
+		if i > 0 {
+			f.Links = append(f.Links, [2]string{e.g.Nodes[i-1].ID + ".tote", n.ID + ".tote"})
+		}
+		f.Links = append(f.Links, [2]string{n.ID + ".tote", n.ID + ".err"})
+	}
+	return f
+}
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"math"
+	"strconv"
+	"sync"
+
+	"github.com/RickF71/tag-go/internal/mech"
+	"github.com/RickF71/tag-go/internal/tag"
+)
+
+// DefaultMasses is the size of the mechchain demo's chain.
+const DefaultMasses = 8
+
+// mechTolerance is the displacement, and speed, below which a mass is at rest.
+const mechTolerance = 0.01
+
+// Mech adapts a mech.Chain. Masses are named "m0", "m1", …; a mass's error
+// is its displacement from rest.
+type Mech struct {
+	mu sync.Mutex
+	c  *mech.Chain
+	n  int
+}
+
+func NewMech(n int) *Mech { return &Mech{c: mech.NewChain(n), n: n} }
+
+func (e *Mech) Kind() string { return KindMech }
+
+func (e *Mech) Step() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.c.Step()
+}
+
+// Reset puts every mass back at rest but keeps the anchors and timestep.
+func (e *Mech) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	c := mech.NewChain(e.n)
+	c.TopK, c.BotK, c.Dt = e.c.TopK, e.c.BotK, e.c.Dt
+	e.c = c
+}
+
+// Set moves mass i and stops it, as the demo's drag does.
+func (e *Mech) Set(i int, p mech.Vec2) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.c.Set(i, p)
+}
+
+func massID(i int) string { return "m" + strconv.Itoa(i) }
+
+func (e *Mech) atRest(i int) bool {
+	v := e.c.Masses[i].V
+	return e.c.Displacement(i) < mechTolerance && math.Hypot(v.X, v.Y) < mechTolerance
+}
+
+func (e *Mech) Snapshot() Snapshot {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s := Snapshot{Kind: KindMech, Step: e.c.Steps, Settled: true, Values: map[string]float64{}}
+	for i := range e.c.Masses {
+		d := e.c.Displacement(i)
+		s.Values[massID(i)] = d
+		s.Error += d
+		s.Settled = s.Settled && e.atRest(i)
+	}
+	return s
+}
+
+func (e *Mech) Params() Params {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return Params{"top_k": e.c.TopK, "bot_k": e.c.BotK, "dt": e.c.Dt}
+}
+
+func (e *Mech) SetParams(p Params) error {
+	if err := positive(p); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return apply(p, []string{"bot_k", "dt", "top_k"}, func(name string, v float64) {
+		switch name {
+		case "top_k":
+			e.c.TopK = v
+		case "bot_k":
+			e.c.BotK = v
+		case "dt":
+			e.c.Dt = v
+		}
+	})
+}
+
+// Frame maps the chain's rest span onto the normalised frame, so masses at
+// rest sit where line() would put them.
+func (e *Mech) Frame() tag.Frame {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	f := tag.Frame{
+		Schema: tag.SchemaVersion, Step: e.c.Steps, Equilibria: map[string]bool{}, ErrScalars: map[string]float64{},
+		Bubbles: []tag.Bubble{}, Links: [][2]string{},
+	}
+	span := math.Max(mech.RestLen, float64(e.n-1)*mech.RestLen)
+	scale := 1.7 / span
+	for i, m := range e.c.Masses {
+		id, d := massID(i), e.c.Displacement(i)
+		at := [2]float64{-0.85 + m.P.X*scale, m.P.Y * scale}
+		f.Equilibria[id] = e.atRest(i)
+		f.ErrScalars[id] = d
+		f.Bubbles = append(f.Bubbles,
+			tag.Bubble{ID: id, Label: id + ".tote", Kind: "tote", Center: at, Radius: 0.04, Energy: m.M, ColorHint: "primary"},
+			tag.Bubble{
+				ID: id, Label: id + ".err", Kind: "error", Center: [2]float64{at[0], at[1] - 0.15},
+				Radius: 0.01 + 0.06*math.Min(1, d/mech.RestLen), Excess: d, Energy: d, ColorHint: "error",
+			})
+		if i > 0 {
+			f.Links = append(f.Links, [2]string{massID(i-1) + ".tote", id + ".tote"})
+		}
+		f.Links = append(f.Links, [2]string{id + ".tote", id + ".err"})
+	}
+	return f
+}
@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/RickF71/tag-go/internal/tag"
+)
+
+// Record is one sampled moment of an engine: its snapshot and, when asked
+// for, its frame. Streams and recordings are sequences of Records.
+type Record struct {
+	Snapshot Snapshot   `json:"snapshot"`
+	Frame    *tag.Frame `json:"frame,omitempty"`
+}
+
+// Sample records e now.
+func Sample(e Engine, frame bool) Record {
+	r := Record{Snapshot: e.Snapshot()}
+	if frame {
+		f := e.Frame()
+		r.Frame = &f
+	}
+	return r
+}
+
+// Recorder writes Records as JSONL, one line per sample.
+type Recorder struct {
+	enc    *json.Encoder
+	frames bool
+	n      int
+}
+
+// NewRecorder writes to w; frames adds the drawable frame to each line.
+func NewRecorder(w io.Writer, frames bool) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w), frames: frames}
+}
+
+// Sample writes one Record of e.
+func (r *Recorder) Sample(e Engine) error {
+	if err := r.enc.Encode(Sample(e, r.frames)); err != nil {
+		return err
+	}
+	r.n++
+	return nil
+}
+
+// Samples reports how many Records have been written.
+func (r *Recorder) Samples() int { return r.n }
+
+// Run steps e the given number of times, sampling before the first step,
+// every `every` steps and after the last. It stops early once e settles
+// unless untilSettled is false.
+func Run(e Engine, rec *Recorder, steps, every int, untilSettled bool) error {
+	if steps < 0 || every <= 0 {
+		return fmt.Errorf("steps must be >= 0 and every > 0")
+	}
+	if err := rec.Sample(e); err != nil {
+		return err
+	}
+	for i := 1; i <= steps; i++ {
+		e.Step()
+		last := i == steps
+		if untilSettled && e.Snapshot().Settled {
+			last = true
+		}
+		if i%every == 0 || last {
+			if err := rec.Sample(e); err != nil {
+				return err
+			}
+		}
+		if last {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package engine
+
+import "github.com/RickF71/tag-go/internal/tag"
+
+// Tote adapts a tag.Simulation; Step, Reset and Frame come straight from it.
+type Tote struct {
+	*tag.Simulation
+}
+
+func NewTote(s *tag.Simulation) *Tote { return &Tote{s} }
+
+func (t *Tote) Kind() string { return KindTote }
+
+func (t *Tote) Snapshot() Snapshot {
+	st := t.State()
+	f := t.Frame()
+	return Snapshot{
+		Kind: KindTote, Step: st.Step, Error: st.TotalError,
+		Settled: t.Idle(), Values: f.ErrScalars,
+	}
+}
+
+func (t *Tote) Params() Params {
+	p := t.Simulation.Params()
+	return Params{"viscosity": p.Viscosity, "limit": p.Limit, "dt": p.Dt}
+}
+
+func (t *Tote) SetParams(p Params) error {
+	var np tag.ParamsPatch
+	err := apply(p, []string{"dt", "limit", "viscosity"}, func(name string, v float64) {
+		switch name {
+		case "viscosity":
+			np.Viscosity = &v
+		case "limit":
+			np.Limit = &v
+		case "dt":
+			np.Dt = &v
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return t.Simulation.SetParams(np)
+}
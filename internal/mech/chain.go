@@ -0,0 +1,120 @@
+// Package mech is the mass-spring chain behind the mechchain demo: masses
+// joined by damped springs, with the two ends held by anchor springs.
+package mech
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	RestLen = 1.0 // rest length between neighbours
+	Gravity = 0.0 // disabled for pure spring behaviour
+)
+
+// Vec2 = 2D vector
+type Vec2 struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Mass = one node in chain
+type Mass struct {
+	P, V, F Vec2    // position, velocity, accumulated force
+	M, K, C float64 // mass, spring stiffness, damping
+}
+
+// Chain is not safe for concurrent use; callers serialise access.
+type Chain struct {
+	Masses     []*Mass
+	TopK, BotK float64 // anchor stiffness at either end
+	Dt         float64 // integration timestep
+	Steps      int
+}
+
+// NewChain lays n masses out at rest along the X axis.
+func NewChain(n int) *Chain {
+	c := &Chain{Masses: make([]*Mass, n), TopK: 100, BotK: 100, Dt: 0.02}
+	for i := range c.Masses {
+		c.Masses[i] = &Mass{P: Vec2{X: float64(i) * RestLen}, M: 1.0, K: 40.0, C: 1.5}
+	}
+	return c
+}
+
+// Step integrates forces once.
+func (c *Chain) Step() {
+	sys := c.Masses
+	if len(sys) == 0 {
+		return
+	}
+
+	// clear forces
+	for _, m := range sys {
+		m.F = Vec2{}
+	}
+
+	// Anchors
+	left := sys[0]
+	right := sys[len(sys)-1]
+
+	left.F.X += -c.TopK * left.P.X
+
+	target := float64(len(sys)-1) * RestLen
+	right.F.X += -c.BotK * (right.P.X - target)
+
+	// Internal springs
+	for i := 0; i < len(sys)-1; i++ {
+		left := sys[i]
+		right := sys[i+1]
+		dx := right.P.X - left.P.X
+		dy := right.P.Y - left.P.Y
+		dist := math.Hypot(dx, dy)
+		if dist == 0 {
+			continue
+		}
+		ux, uy := dx/dist, dy/dist
+		fs := left.K * (dist - RestLen)
+		fv := left.C * ((right.V.X-left.V.X)*ux + (right.V.Y-left.V.Y)*uy)
+		f := fs + fv
+		left.F.X += f * ux
+		left.F.Y += f * uy
+		right.F.X -= f * ux
+		right.F.Y -= f * uy
+	}
+
+	// Integrate
+	for _, m := range sys {
+		ax := m.F.X / m.M
+		ay := m.F.Y/m.M + Gravity
+		m.V.X += ax * c.Dt
+		m.V.Y += ay * c.Dt
+		m.P.X += m.V.X * c.Dt
+		m.P.Y += m.V.Y * c.Dt
+	}
+	c.Steps++
+}
+
+// Set moves mass i to p and stops it.
+func (c *Chain) Set(i int, p Vec2) error {
+	if i < 0 || i >= len(c.Masses) {
+		return fmt.Errorf("invalid id %d", i)
+	}
+	c.Masses[i].P = p
+	c.Masses[i].V = Vec2{}
+	return nil
+}
+
+// Positions returns every mass position, first to last.
+func (c *Chain) Positions() []Vec2 {
+	out := make([]Vec2, len(c.Masses))
+	for i, m := range c.Masses {
+		out[i] = m.P
+	}
+	return out
+}
+
+// Displacement is how far mass i sits from its rest position.
+func (c *Chain) Displacement(i int) float64 {
+	p := c.Masses[i].P
+	return math.Hypot(p.X-float64(i)*RestLen, p.Y)
+}
@@ -4,39 +4,405 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 )
 
 // RegisterRoutes exposes /api/tag/* endpoints.
-func RegisterRoutes(mux *http.ServeMux, sim *Simulation) {
-	mux.HandleFunc("/api/tag/state", func(w http.ResponseWriter, r *http.Request) {
+func RegisterRoutes(m *http.ServeMux, sim *Simulation) {
+	mux := NewRouter(m)
+	registerRoutes(mux, sim, nil)
+	mux.Finish()
+}
+
+func registerRoutes(mux *Router, sim *Simulation, forks *forkSet) {
+	mux.audit = sim
+	registerTimeTravel(mux, sim, forks)
+
+	mux.HandleFunc("GET /api/tag/state", func(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(sim.Snapshot())
 	})
 
-	mux.HandleFunc("/api/tag/step", func(w http.ResponseWriter, r *http.Request) {
+	// frame is the drawable view: positioned bubbles, links and error scalars.
+	mux.HandleFunc("GET /api/tag/frame", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(sim.Frame())
+	})
+
+	mux.HandleFunc("POST /api/tag/step", func(w http.ResponseWriter, r *http.Request) {
 		sim.Step()
 		json.NewEncoder(w).Encode(sim.Snapshot())
 	})
 
-	mux.HandleFunc("/api/tag/reset", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("POST /api/tag/run", func(w http.ResponseWriter, r *http.Request) {
+		var req RunRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, BadJSON(err))
+			return
+		}
+		limit, conds, err := req.Conditions()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		sum, err := sim.RunUntil(limit, conds...)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(sum)
+	})
+
+	mux.HandleFunc("POST /api/tag/reset", func(w http.ResponseWriter, r *http.Request) {
 		sim.Reset()
 		json.NewEncoder(w).Encode(sim.Snapshot())
 	})
 
-	mux.HandleFunc("/api/tag/params", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodPost {
-			var p Params
-			json.NewDecoder(r.Body).Decode(&p)
-			sim.UpdateParams(p)
+	mux.HandleFunc("GET /api/tag/params", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(sim.Params())
+	})
+
+	// params updates are partial: absent fields keep their value, zero is a value.
+	setParams := func(w http.ResponseWriter, r *http.Request) {
+		var p ParamsPatch
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&p); err != nil {
+			writeError(w, BadJSON(err))
+			return
+		}
+		if err := sim.SetParams(p); err != nil {
+			writeError(w, err)
+			return
 		}
 		json.NewEncoder(w).Encode(sim.Params())
+	}
+	mux.HandleFunc("POST /api/tag/params", setParams)
+	mux.HandleFunc("PATCH /api/tag/params", setParams)
+
+	mux.HandleFunc("POST /api/tag/ingest", func(w http.ResponseWriter, r *http.Request) {
+		obs, err := DecodeObservations(r.Body)
+		if err != nil {
+			writeError(w, fmt.Errorf("invalid observations: %w", err))
+			return
+		}
+		n, err := sim.Ingest(obs...)
+		if err != nil {
+			writeError(w, fmt.Errorf("observation %d: %w", n, err))
+			return
+		}
+		json.NewEncoder(w).Encode(IngestResult{Accepted: n})
+	})
+
+	// --- receipts ---
+
+	mux.HandleFunc("GET /api/tag/receipts", func(w http.ResponseWriter, r *http.Request) {
+		q, err := parseQuery(r.URL.Query())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(sim.Receipts(q))
+	})
+
+	// export streams every retained receipt as JSONL; the chain head travels in a
+	// header so `tag verify -head` can also detect receipts cut from the end.
+	mux.HandleFunc("GET /api/tag/receipts/export", func(w http.ResponseWriter, r *http.Request) {
+		rs := sim.Snapshot().Receipts
+		if on, head := sim.HashChain(); on || head != "" {
+			w.Header().Set("X-Tag-Chain-Head", head)
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		for _, rc := range rs {
+			enc.Encode(rc)
+		}
+	})
+
+	// graph exports the causal graph of the retained receipts, optionally narrowed
+	// to the causes (or, with dir=effects, the effects) of one receipt.
+	mux.HandleFunc("GET /api/tag/receipts/graph", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		g := NewCausalGraph(sim.Snapshot().Receipts)
+		if v := q.Get("id"); v != "" {
+			id, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				writeError(w, fmt.Errorf("id: %w", err))
+				return
+			}
+			if _, ok := g.Receipt(id); !ok {
+				writeError(w, fmt.Errorf("receipt %d: %w", id, ErrNotFound))
+				return
+			}
+			if q.Get("dir") == "effects" {
+				g = g.Effects(id)
+			} else {
+				g = g.Causes(id)
+			}
+		}
+		if q.Get("format") == "dot" {
+			w.Header().Set("Content-Type", "text/vnd.graphviz")
+			g.WriteDOT(w)
+			return
+		}
+		json.NewEncoder(w).Encode(g)
+	})
+
+	mux.HandleFunc("GET /api/tag/explain", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		from, to := 0, 0
+		for _, p := range []struct {
+			name string
+			dst  *int
+		}{{"from_step", &from}, {"to_step", &to}} {
+			if v := q.Get(p.name); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					writeError(w, fmt.Errorf("%s: %w", p.name, err))
+					return
+				}
+				*p.dst = n
+			}
+		}
+		json.NewEncoder(w).Encode(sim.Explain(from, to))
+	})
+
+	chain := func(w http.ResponseWriter) {
+		on, head := sim.HashChain()
+		json.NewEncoder(w).Encode(ChainStatus{Enabled: on, Head: head})
+	}
+	mux.HandleFunc("GET /api/tag/chain", func(w http.ResponseWriter, r *http.Request) { chain(w) })
+
+	mux.HandleFunc("POST /api/tag/chain", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Enabled bool `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, BadJSON(err))
+			return
+		}
+		sim.SetHashChain(req.Enabled)
+		chain(w)
+	})
+
+	mux.HandleFunc("GET /api/tag/retention", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(sim.Retention())
+	})
+
+	mux.HandleFunc("POST /api/tag/retention", func(w http.ResponseWriter, r *http.Request) {
+		var ret Retention
+		if err := json.NewDecoder(r.Body).Decode(&ret); err != nil {
+			writeError(w, BadJSON(err))
+			return
+		}
+		if err := sim.SetRetention(ret); err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(sim.Retention())
+	})
+
+	// --- checkpoints ---
+
+	mux.HandleFunc("GET /api/tag/checkpoint", func(w http.ResponseWriter, r *http.Request) {
+		cp, err := sim.Checkpoint()
+		if err != nil {
+			writeError(w, &APIError{Status: http.StatusConflict, Code: CodeConflict, Message: err.Error()})
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="tag-step%d.json"`, cp.Step))
+		cp.WriteTo(w)
+	})
+
+	mux.HandleFunc("POST /api/tag/checkpoint", func(w http.ResponseWriter, r *http.Request) {
+		cp, err := ReadCheckpoint(r.Body)
+		if err != nil {
+			writeError(w, fmt.Errorf("invalid checkpoint: %w", err))
+			return
+		}
+		if err := sim.Restore(cp); err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(sim.Snapshot())
+	})
+
+	// --- topology ---
+
+	mux.HandleFunc("GET /api/tag/bubbles", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(sim.Bubbles())
+	})
+
+	mux.HandleFunc("POST /api/tag/bubbles", func(w http.ResponseWriter, r *http.Request) {
+		var spec BubbleSpec
+		if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+			writeError(w, BadJSON(err))
+			return
+		}
+		if err := sim.AddBubble(spec); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		b, _ := sim.Bubble(spec.ID)
+		json.NewEncoder(w).Encode(b)
+	})
+
+	mux.HandleFunc("GET /api/tag/bubbles/{id}", func(w http.ResponseWriter, r *http.Request) {
+		b, err := sim.Bubble(r.PathValue("id"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(b)
+	})
+
+	mux.HandleFunc("PATCH /api/tag/bubbles/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var p BubblePatch
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			writeError(w, BadJSON(err))
+			return
+		}
+		id := r.PathValue("id")
+		if err := sim.SetBubble(id, p); err != nil {
+			writeError(w, err)
+			return
+		}
+		b, _ := sim.Bubble(id)
+		json.NewEncoder(w).Encode(b)
+	})
+
+	mux.HandleFunc("DELETE /api/tag/bubbles/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if err := sim.RemoveBubble(r.PathValue("id")); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST /api/tag/bubbles/{id}/link", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			After string `json:"after"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, BadJSON(err))
+			return
+		}
+		id := r.PathValue("id")
+		if err := sim.Relink(id, body.After); err != nil {
+			writeError(w, err)
+			return
+		}
+		b, _ := sim.Bubble(id)
+		json.NewEncoder(w).Encode(b)
 	})
 
-	mux.HandleFunc("/api/tag/stream", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("GET /api/tag/bubbles/{id}/history", func(w http.ResponseWriter, r *http.Request) {
+		h, err := sim.History(r.PathValue("id"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(h)
+	})
+
+	// rpc serves the same operations over JSON-RPC 2.0; see RPC. ws carries
+	// the same messages both ways, so it can also push events.
+	rpc := NewRPC(sim)
+	mux.HandleFuncRole("POST /api/tag/rpc", RoleRead, rpc.ServeHTTP)
+	mux.HandleFunc("GET /api/tag/ws", rpc.ServeWebSocket)
+
+	// --- streaming ---
+
+	clock := sim.Clock()
+
+	mux.HandleFunc("GET /api/tag/clock", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(clock.Status())
+	})
+
+	mux.HandleFunc("POST /api/tag/clock", func(w http.ResponseWriter, r *http.Request) {
+		var u ClockUpdate
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			writeError(w, BadJSON(err))
+			return
+		}
+		if err := clock.Update(u); err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(clock.Status())
+	})
+
+	mux.HandleFunc("GET /api/tag/stream", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, &APIError{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "streaming unsupported"})
+			return
+		}
 		w.Header().Set("Content-Type", "text/event-stream")
-		flusher, _ := w.(http.Flusher)
-		for b := range sim.Stream() {
-			fmt.Fprintf(w, "data: %s\n\n", b)
-			flusher.Flush()
+		w.Header().Set("Cache-Control", "no-cache")
+
+		// resume from Last-Event-ID, or ?since_step=N, or start from now
+		cur := NewStreamCursor(sim.Cursor())
+		if id, err := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64); err == nil {
+			cur = NewStreamCursor(id)
+		} else if step, err := strconv.Atoi(r.URL.Query().Get("since_step")); err == nil {
+			cur = NewStreamCursor(sim.CursorAfterStep(step))
+		}
+		cur.WithFrame = r.URL.Query().Get("frame") == "1"
+		filter := ParseReceiptFilter(r.URL.Query())
+
+		ticks, cancel := clock.Subscribe(0)
+		defer cancel()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case _, ok := <-ticks:
+				if !ok {
+					return
+				}
+				fr, changed := sim.NextFrame(cur, filter)
+				if !changed {
+					continue
+				}
+				b, _ := json.Marshal(fr)
+				fmt.Fprintf(w, "id: %d\ndata: %s\n\n", fr.Cursor, b)
+				flusher.Flush()
+			}
 		}
 	})
 }
+
+// IngestResult is the body of a successful /api/tag/ingest.
+type IngestResult struct {
+	Accepted int `json:"accepted"`
+}
+
+// ChainStatus is the body of /api/tag/chain.
+type ChainStatus struct {
+	Enabled bool   `json:"enabled"`
+	Head    string `json:"head"`
+}
+
+// parseQuery reads from_step, to_step, types, subject, q, cursor and limit.
+func parseQuery(v url.Values) (Query, error) {
+	q := Query{Filter: ParseReceiptFilter(v), Text: v.Get("q")}
+	for name, dst := range map[string]*int{"from_step": &q.FromStep, "to_step": &q.ToStep, "limit": &q.Limit} {
+		if s := v.Get(name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return q, fmt.Errorf("%s must be a non-negative integer", name)
+			}
+			*dst = n
+		}
+	}
+	if s := v.Get("cursor"); s != "" {
+		c, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return q, fmt.Errorf("invalid cursor %q", s)
+		}
+		q.Cursor = c
+	}
+	return q, nil
+}
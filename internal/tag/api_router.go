@@ -0,0 +1,155 @@
+package tag
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Error codes carried by APIError.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeInvalidJSON      = "invalid_json"
+	CodeInvalidParam     = "invalid_param"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeConflict         = "conflict"
+	CodeLimit            = "limit_reached"
+	CodeJournal          = "journal_failed"
+	CodeInternal         = "internal"
+)
+
+// ErrorEnvelope is the JSON body of every error response.
+type ErrorEnvelope struct {
+	Error *APIError `json:"error"`
+}
+
+// APIError describes what went wrong.
+type APIError struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"` // offending parameter, for invalid_param
+}
+
+func (e *APIError) Error() string { return e.Message }
+
+// AsAPIError maps simulation errors onto HTTP statuses and codes.
+func AsAPIError(err error) *APIError {
+	var ae *APIError
+	if errors.As(err, &ae) {
+		return ae
+	}
+	ae = &APIError{Status: http.StatusBadRequest, Code: CodeBadRequest, Message: err.Error()}
+	var pe *ParamError
+	switch {
+	case errors.As(err, &pe):
+		ae.Code, ae.Field = CodeInvalidParam, pe.Field
+	case errors.Is(err, ErrNotFound):
+		ae.Status, ae.Code = http.StatusNotFound, CodeNotFound
+	case errors.Is(err, ErrLimit):
+		ae.Status, ae.Code = http.StatusTooManyRequests, CodeLimit
+	case errors.Is(err, ErrJournal):
+		ae.Status, ae.Code = http.StatusServiceUnavailable, CodeJournal
+	}
+	return ae
+}
+
+// writeError answers with the APIError for err.
+func writeError(w http.ResponseWriter, err error) {
+	ae := AsAPIError(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(ae.Status)
+	json.NewEncoder(w).Encode(ErrorEnvelope{Error: ae})
+}
+
+// WriteError is writeError for other packages serving the same API shape.
+func WriteError(w http.ResponseWriter, err error) { writeError(w, err) }
+
+// BadJSON wraps a request body decode error.
+func BadJSON(err error) error {
+	return &APIError{Status: http.StatusBadRequest, Code: CodeInvalidJSON, Message: "invalid JSON: " + err.Error()}
+}
+
+// Router registers "METHOD /path" handlers on a ServeMux and, once finished,
+// answers every other method on those paths with a structured 405. When
+// requests carry a Principal (see Auth), GET and HEAD routes need the read
+// role and the rest the control role.
+type Router struct {
+	mux   *http.ServeMux
+	allow map[string][]string
+	paths []string
+	audit *Simulation // where control routes registered from now on record who called them
+}
+
+func NewRouter(mux *http.ServeMux) *Router {
+	return &Router{mux: mux, allow: map[string][]string{}}
+}
+
+// HandleFunc takes the same patterns as http.ServeMux. Patterns without a
+// method match every method and get no 405 fallback or role check; they are
+// for proxies onto other Routers.
+func (rt *Router) HandleFunc(pattern string, h http.HandlerFunc) {
+	method, _, ok := strings.Cut(pattern, " ")
+	need := RoleNone
+	switch {
+	case !ok:
+	case method == http.MethodGet || method == http.MethodHead:
+		need = RoleRead
+	default:
+		need = RoleControl
+	}
+	rt.HandleFuncRole(pattern, need, h)
+}
+
+// HandleFuncRole is HandleFunc with an explicit role, for routes such as
+// JSON-RPC that check finer-grained permissions themselves, and proxies that
+// must not act for callers without any role.
+func (rt *Router) HandleFuncRole(pattern string, need Role, h http.HandlerFunc) {
+	rt.mux.HandleFunc(pattern, rt.guard(need, h))
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		return
+	}
+	if rt.allow[path] == nil {
+		rt.paths = append(rt.paths, path)
+	}
+	rt.allow[path] = append(rt.allow[path], method)
+}
+
+// Routes lists every "METHOD /path" pattern registered so far.
+func (rt *Router) Routes() []string {
+	var out []string
+	for _, path := range rt.paths {
+		for _, m := range rt.allow[path] {
+			out = append(out, m+" "+path)
+		}
+	}
+	return out
+}
+
+// Finish registers the 405 fallbacks.
+func (rt *Router) Finish() {
+	for _, path := range rt.paths {
+		methods := append([]string(nil), rt.allow[path]...)
+		for _, m := range methods {
+			if m == http.MethodGet {
+				methods = append(methods, http.MethodHead)
+			}
+		}
+		sort.Strings(methods)
+		allow := strings.Join(methods, ", ")
+		rt.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Allow", allow)
+			writeError(w, &APIError{
+				Status: http.StatusMethodNotAllowed, Code: CodeMethodNotAllowed,
+				Message: r.Method + " not allowed; use " + allow,
+			})
+		})
+	}
+}
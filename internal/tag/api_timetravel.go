@@ -0,0 +1,310 @@
+package tag
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ForkInfo describes a sandbox branch of the main simulation.
+type ForkInfo struct {
+	ID      string    `json:"id"`
+	Since   int       `json:"since"` // step the branch shares with its parent
+	Step    int       `json:"step"`
+	Created time.Time `json:"created"`
+}
+
+// ForkLimits bounds the forks of one simulation, its forks' forks
+// included; tagd sets it from its flags. Zero fields mean unlimited.
+var ForkLimits = HostLimits{MaxSims: 16, MaxRunning: 4, IdleAfter: 30 * time.Minute}
+
+type fork struct {
+	info     ForkInfo
+	parent   *Simulation
+	sim      *Simulation
+	mux      *http.ServeMux
+	lastUsed time.Time
+	active   int // requests in flight, including open streams
+}
+
+// forkSet holds every fork descended from one simulation, so ForkLimits
+// applies to the whole family however deeply it is forked.
+type forkSet struct {
+	limits HostLimits
+
+	mu       sync.Mutex
+	next     int
+	forks    map[string]*fork
+	sweeping bool // a janitor runs while there are forks
+}
+
+func newForkSet(limits HostLimits) *forkSet {
+	return &forkSet{limits: limits, forks: map[string]*fork{}}
+}
+
+// add keeps a new fork of parent, refusing it at MaxSims.
+func (fs *forkSet) add(parent, sim *Simulation) (*fork, error) {
+	if err := sim.Clock().SetRates(fs.limits.Rates); err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.limits.MaxSims > 0 && len(fs.forks) >= fs.limits.MaxSims {
+		return nil, fmt.Errorf("%d forks kept: %w", len(fs.forks), ErrLimit)
+	}
+	fs.next++
+	now := time.Now().UTC()
+	f := &fork{parent: parent, sim: sim, mux: http.NewServeMux(), lastUsed: now}
+	f.info = ForkInfo{ID: fmt.Sprintf("f%d", fs.next), Since: sim.Snapshot().Step, Created: now}
+	rt := NewRouter(f.mux)
+	registerRoutes(rt, sim, fs)
+	rt.Finish()
+	fs.forks[f.info.ID] = f
+	if !fs.sweeping {
+		fs.sweeping = true
+		go fs.janitor()
+	}
+	return f, nil
+}
+
+// list returns parent's own forks.
+func (fs *forkSet) list(parent *Simulation) []*fork {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	var list []*fork
+	for _, f := range fs.forks {
+		if f.parent == parent {
+			list = append(list, f)
+		}
+	}
+	return list
+}
+
+// acquire marks one of parent's forks busy for a request. Streams start the
+// fork's clock, so they are admitted only below MaxRunning.
+func (fs *forkSet) acquire(parent *Simulation, id string, stream bool) (*fork, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	f := fs.forks[id]
+	if f == nil || f.parent != parent {
+		return nil, fmt.Errorf("fork %q: %w", id, ErrNotFound)
+	}
+	if stream {
+		c := f.sim.Clock()
+		if !c.Status().Running {
+			if n := fs.running(); fs.limits.MaxRunning > 0 && n >= fs.limits.MaxRunning {
+				return nil, fmt.Errorf("%d forks running: %w", n, ErrLimit)
+			}
+			c.Start()
+		}
+	}
+	f.active++
+	f.lastUsed = time.Now().UTC()
+	return f, nil
+}
+
+func (fs *forkSet) release(f *fork) {
+	fs.mu.Lock()
+	f.active--
+	f.lastUsed = time.Now().UTC()
+	fs.mu.Unlock()
+}
+
+// running counts running fork clocks; callers hold fs.mu.
+func (fs *forkSet) running() int {
+	n := 0
+	for _, f := range fs.forks {
+		if f.sim.Clock().Status().Running {
+			n++
+		}
+	}
+	return n
+}
+
+// remove drops one of parent's forks and, with it, every fork made from it.
+func (fs *forkSet) remove(parent *Simulation, id string) error {
+	fs.mu.Lock()
+	f := fs.forks[id]
+	if f == nil || f.parent != parent {
+		fs.mu.Unlock()
+		return fmt.Errorf("fork %q: %w", id, ErrNotFound)
+	}
+	dropped := fs.drop(f)
+	fs.mu.Unlock()
+	for _, d := range dropped {
+		d.sim.Clock().Close()
+	}
+	return nil
+}
+
+// drop forgets f and its descendants; callers hold fs.mu and close the
+// clocks of what it returns.
+func (fs *forkSet) drop(f *fork) []*fork {
+	delete(fs.forks, f.info.ID)
+	dropped := []*fork{f}
+	for _, c := range fs.forks {
+		if c.parent == f.sim {
+			dropped = append(dropped, fs.drop(c)...)
+		}
+	}
+	return dropped
+}
+
+// janitor stops fork clocks nobody is watching and evicts idle forks. It
+// exits once the family has no forks left.
+func (fs *forkSet) janitor() {
+	every := 10 * time.Second
+	if fs.limits.IdleAfter > 0 && fs.limits.IdleAfter/4 < every {
+		every = max(fs.limits.IdleAfter/4, 10*time.Millisecond)
+	}
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for now := range t.C {
+		if !fs.sweep(now) {
+			return
+		}
+	}
+}
+
+// sweep reports whether any forks remain.
+func (fs *forkSet) sweep(now time.Time) bool {
+	var idle, evict []*fork
+	fs.mu.Lock()
+	for _, f := range fs.forks {
+		switch {
+		case f.active > 0:
+		case fs.limits.IdleAfter > 0 && now.Sub(f.lastUsed) > fs.limits.IdleAfter:
+			evict = append(evict, fs.drop(f)...)
+		default:
+			idle = append(idle, f)
+		}
+	}
+	left := len(fs.forks) > 0
+	fs.sweeping = left
+	fs.mu.Unlock()
+	for _, f := range evict {
+		f.sim.Clock().Close()
+	}
+	for _, f := range idle {
+		if c := f.sim.Clock(); c.B.Subscribers() == 0 {
+			c.Stop()
+		}
+	}
+	return left
+}
+
+func (f *fork) describe() ForkInfo {
+	fi := f.info
+	fi.Step = f.sim.Snapshot().Step
+	return fi
+}
+
+// registerTimeTravel exposes rewinding and forks. Each fork gets the full
+// /api/tag/* API of its own under /api/tag/forks/{id}/ and shares forks, the
+// family's forkSet; nil starts a new family under ForkLimits.
+func registerTimeTravel(mux *Router, sim *Simulation, forks *forkSet) {
+	if forks == nil {
+		forks = newForkSet(ForkLimits)
+	}
+
+	mux.HandleFunc("GET /api/tag/rewind", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(sim.RewindRange())
+	})
+
+	mux.HandleFunc("POST /api/tag/rewind", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Step *int `json:"step"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Step == nil {
+			writeError(w, fmt.Errorf(`body must be {"step": N}`))
+			return
+		}
+		if err := sim.Rewind(*req.Step); err != nil {
+			writeError(w, err)
+			return
+		}
+		json.NewEncoder(w).Encode(sim.Snapshot())
+	})
+
+	mux.HandleFunc("GET /api/tag/forks", func(w http.ResponseWriter, r *http.Request) {
+		list := forks.list(sim)
+		infos := make([]ForkInfo, 0, len(list))
+		for _, f := range list {
+			infos = append(infos, f.describe())
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Created.Before(infos[j].Created) })
+		json.NewEncoder(w).Encode(infos)
+	})
+
+	mux.HandleFunc("POST /api/tag/forks", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Step *int `json:"step,omitempty"` // default: now
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, BadJSON(err))
+				return
+			}
+		}
+		var (
+			f   *Simulation
+			err error
+		)
+		if req.Step != nil {
+			f, err = sim.ForkAt(*req.Step)
+		} else {
+			f, err = sim.Fork()
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		fk, err := forks.add(sim, f)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(fk.describe())
+	})
+
+	mux.HandleFunc("DELETE /api/tag/forks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if err := forks.remove(sim, r.PathValue("id")); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// diff compares the fork (b) with the main simulation (a) since the fork point.
+	mux.HandleFunc("GET /api/tag/forks/{id}/diff", func(w http.ResponseWriter, r *http.Request) {
+		f, err := forks.acquire(sim, r.PathValue("id"), false)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		defer forks.release(f)
+		json.NewEncoder(w).Encode(Diff(sim, f.sim, f.info.Since))
+	})
+
+	// the read role is checked before acquire can start a clock; the fork's
+	// router checks the rest
+	mux.HandleFuncRole("/api/tag/forks/{id}/", RoleRead, func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		rest := strings.TrimPrefix(r.URL.Path, "/api/tag/forks/"+id)
+		f, err := forks.acquire(sim, id, rest == "/stream" || rest == "/ws")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		defer forks.release(f)
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = "/api/tag" + rest
+		r2.URL.RawPath = ""
+		f.mux.ServeHTTP(w, r2)
+	})
+}
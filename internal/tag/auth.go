@@ -0,0 +1,235 @@
+package tag
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Role is what a caller may do; control includes read.
+type Role string
+
+const (
+	RoleNone    Role = ""
+	RoleRead    Role = "read"    // GET endpoints, streams and read-only RPC methods
+	RoleControl Role = "control" // every mutating endpoint and RPC method
+)
+
+func (r Role) rank() int {
+	switch r {
+	case RoleRead:
+		return 1
+	case RoleControl:
+		return 2
+	}
+	return 0
+}
+
+// Allows reports whether r may do what need requires.
+func (r Role) Allows(need Role) bool { return r.rank() >= need.rank() }
+
+// Principal is who a request acts as. Name is empty for anonymous callers.
+type Principal struct {
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+}
+
+// who names the principal in audit receipts.
+func (p Principal) who() string {
+	if p.Name == "" {
+		return "anonymous"
+	}
+	return p.Name
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the caller of an authenticated request; ok is false
+// when auth is off, in which case everything is allowed.
+func PrincipalFrom(ctx context.Context) (p Principal, ok bool) {
+	p, ok = ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// AuthConfig is the token file, e.g.
+//
+//	{"anonymous": "read", "tokens": [
+//	  {"name": "ops", "role": "control", "sha256": "9f86d0…"},
+//	  {"name": "dash", "role": "read", "token": "s3cret"}]}
+type AuthConfig struct {
+	Anonymous Role          `json:"anonymous"` // role of requests without a token; "" requires one
+	Tokens    []TokenConfig `json:"tokens"`
+}
+
+// TokenConfig grants Role to whoever presents Token, or a token whose hex
+// SHA-256 is SHA256, so the file need not hold the secret itself.
+type TokenConfig struct {
+	Name   string `json:"name"`
+	Role   Role   `json:"role"`
+	Token  string `json:"token,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// Auth identifies callers by bearer token.
+type Auth struct {
+	anon   Role
+	tokens map[[sha256.Size]byte]Principal
+}
+
+func NewAuth(cfg AuthConfig) (*Auth, error) {
+	if cfg.Anonymous != RoleNone && cfg.Anonymous.rank() == 0 {
+		return nil, fmt.Errorf("auth: anonymous: unknown role %q", cfg.Anonymous)
+	}
+	a := &Auth{anon: cfg.Anonymous, tokens: map[[sha256.Size]byte]Principal{}}
+	names := map[string]bool{}
+	for i, t := range cfg.Tokens {
+		if t.Name == "" || names[t.Name] {
+			return nil, fmt.Errorf("auth: token %d: name missing or repeated", i)
+		}
+		names[t.Name] = true
+		if t.Role.rank() == 0 {
+			return nil, fmt.Errorf("auth: token %q: unknown role %q", t.Name, t.Role)
+		}
+		var sum [sha256.Size]byte
+		switch {
+		case t.Token != "" && t.SHA256 == "":
+			sum = sha256.Sum256([]byte(t.Token))
+		case t.Token == "" && t.SHA256 != "":
+			b, err := hex.DecodeString(t.SHA256)
+			if err != nil || len(b) != sha256.Size {
+				return nil, fmt.Errorf("auth: token %q: sha256 must be %d hex bytes", t.Name, sha256.Size)
+			}
+			copy(sum[:], b)
+		default:
+			return nil, fmt.Errorf("auth: token %q: set exactly one of token and sha256", t.Name)
+		}
+		if _, dup := a.tokens[sum]; dup {
+			return nil, fmt.Errorf("auth: token %q: same token as another entry", t.Name)
+		}
+		a.tokens[sum] = Principal{Name: t.Name, Role: t.Role}
+	}
+	return a, nil
+}
+
+// LoadAuth reads a token file.
+func LoadAuth(path string) (*Auth, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg AuthConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, fmt.Errorf("auth: %s: %w", path, err)
+	}
+	return NewAuth(cfg)
+}
+
+// Middleware attaches the caller's Principal to every request. The token is
+// read from "Authorization: Bearer …" or, for browser WebSockets and
+// EventSources that cannot set headers, an access_token query parameter.
+// Unknown tokens are refused here; Router routes check roles.
+func (a *Auth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			token = r.URL.Query().Get("access_token")
+		}
+		p := Principal{Role: a.anon}
+		if token != "" {
+			if p, ok = a.tokens[sha256.Sum256([]byte(token))]; !ok {
+				unauthorized(w, "unknown token")
+				return
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
+
+func unauthorized(w http.ResponseWriter, msg string) {
+	deny(w, &APIError{Status: http.StatusUnauthorized, Code: CodeUnauthorized, Message: msg})
+}
+
+func deny(w http.ResponseWriter, ae *APIError) {
+	if ae.Status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="tagd"`)
+	}
+	writeError(w, ae)
+}
+
+// denied is the error for p lacking need: 401 for anonymous callers, who
+// might have a token, 403 for known ones.
+func denied(p Principal, need Role) *APIError {
+	if p.Name == "" {
+		return &APIError{Status: http.StatusUnauthorized, Code: CodeUnauthorized, Message: fmt.Sprintf("a token with the %s role is required", need)}
+	}
+	return &APIError{Status: http.StatusForbidden, Code: CodeForbidden, Message: fmt.Sprintf("%s has the %s role; %s is required", p.Name, p.Role, need)}
+}
+
+// guard checks the caller's role before h runs and, for control routes of
+// a router with an audit simulation, records successful calls.
+func (rt *Router) guard(need Role, h http.HandlerFunc) http.HandlerFunc {
+	if need == RoleNone {
+		return h
+	}
+	audit := rt.audit
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, ok := PrincipalFrom(r.Context())
+		if !ok {
+			h(w, r)
+			return
+		}
+		if !p.Role.Allows(need) {
+			deny(w, denied(p, need))
+			return
+		}
+		if need != RoleControl || audit == nil {
+			h(w, r)
+			return
+		}
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h(sw, r)
+		if sw.status < 300 {
+			audit.Audit(p.who(), r.Method+" "+r.URL.Path)
+		}
+	}
+}
+
+// statusWriter remembers the status a handler answered with.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// --- audit ---
+
+type auditArgs struct {
+	Who    string `json:"who"`
+	Action string `json:"action"`
+}
+
+// Audit commits an audit receipt saying who did action through the API.
+// It is journaled, so replays and rewinds keep the audit trail.
+func (s *Simulation) Audit(who, action string) {
+	s.mu.Lock()
+	defer s.unlock()
+	if s.journalOp(OpAudit, auditArgs{Who: who, Action: action}) != nil {
+		return
+	}
+	s.commit(Receipt{Step: s.StepNum, Type: RAudit, Subject: who, Note: action})
+}
@@ -0,0 +1,127 @@
+package tag
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// authServer serves sim, a Host and their forks behind a token file with a
+// reader and an operator and no anonymous access.
+func authServer(t *testing.T, sim *Simulation) (http.Handler, *Host) {
+	t.Helper()
+	auth, err := NewAuth(AuthConfig{Tokens: []TokenConfig{
+		{Name: "dash", Role: RoleRead, Token: "read-token"},
+		{Name: "ops", Role: RoleControl, Token: "control-token"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, sim)
+	h := NewHost(HostLimits{})
+	t.Cleanup(h.Close)
+	h.Register(mux, sim)
+	return auth.Middleware(mux), h
+}
+
+func call(h http.Handler, token, method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestAuthRoles(t *testing.T) {
+	sim := NewSimulation()
+	h, host := authServer(t, sim)
+	hosted := NewSimulation()
+	if _, err := host.Add("s1", hosted); err != nil {
+		t.Fatal(err)
+	}
+	if w := call(h, "control-token", "POST", "/api/tag/forks", ""); w.Code != http.StatusCreated {
+		t.Fatalf("fork: %d %s", w.Code, w.Body)
+	}
+
+	for _, tc := range []struct {
+		token, method, path string
+		want                int
+	}{
+		{"", "GET", "/api/tag/state", http.StatusUnauthorized},
+		{"wrong", "GET", "/api/tag/state", http.StatusUnauthorized},
+		{"read-token", "GET", "/api/tag/state", http.StatusOK},
+		{"read-token", "POST", "/api/tag/step", http.StatusForbidden},
+		{"control-token", "POST", "/api/tag/step", http.StatusOK},
+		{"", "GET", "/api/sims", http.StatusUnauthorized},
+		{"read-token", "GET", "/api/sims", http.StatusOK},
+		{"read-token", "POST", "/api/sims", http.StatusForbidden},
+		{"read-token", "DELETE", "/api/sims/s1", http.StatusForbidden},
+		// proxies refuse callers without a role before touching the target
+		{"", "GET", "/api/sims/s1/stream", http.StatusUnauthorized},
+		{"", "GET", "/api/sims/s1/ws", http.StatusUnauthorized},
+		{"", "GET", "/api/tag/forks/f1/stream", http.StatusUnauthorized},
+		{"", "POST", "/api/sims/s1/step", http.StatusUnauthorized},
+		{"read-token", "GET", "/api/sims/s1/state", http.StatusOK},
+		{"read-token", "POST", "/api/sims/s1/step", http.StatusForbidden},
+		{"read-token", "POST", "/api/tag/forks/f1/step", http.StatusForbidden},
+		{"control-token", "POST", "/api/sims/s1/step", http.StatusOK},
+		{"control-token", "POST", "/api/tag/forks/f1/step", http.StatusOK},
+	} {
+		if w := call(h, tc.token, tc.method, tc.path, ""); w.Code != tc.want {
+			t.Errorf("%s %s with %q: %d, want %d (%s)", tc.method, tc.path, tc.token, w.Code, tc.want, strings.TrimSpace(w.Body.String()))
+		}
+	}
+	if hosted.Clock().Status().Running {
+		t.Error("anonymous stream request started the hosted clock")
+	}
+	if hosted.State().Step != 1 {
+		t.Errorf("hosted sim at step %d; only the operator's step should have run", hosted.State().Step)
+	}
+}
+
+func TestAuthAuditsControlRoutes(t *testing.T) {
+	sim := NewSimulation()
+	h, _ := authServer(t, sim)
+	for _, c := range []struct{ method, path, body string }{
+		{"POST", "/api/tag/step", ""},
+		{"POST", "/api/sims", `{"id": "lab"}`},
+		{"DELETE", "/api/sims/lab", ""},
+		{"GET", "/api/tag/state", ""}, // reads are not audited
+	} {
+		if w := call(h, "control-token", c.method, c.path, c.body); w.Code >= 300 {
+			t.Fatalf("%s %s: %d %s", c.method, c.path, w.Code, w.Body)
+		}
+	}
+	call(h, "control-token", "DELETE", "/api/sims/nowhere", "") // failed calls are not audited
+
+	var got []string
+	for _, r := range sim.Snapshot().Receipts {
+		if r.Type == RAudit {
+			got = append(got, r.Subject+": "+r.Note)
+		}
+	}
+	want := []string{"ops: POST /api/tag/step", "ops: POST /api/sims", "ops: DELETE /api/sims/lab"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("audit trail:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestNewAuthRejectsBadConfig(t *testing.T) {
+	for name, cfg := range map[string]AuthConfig{
+		"unknown anonymous role": {Anonymous: "admin"},
+		"unknown token role":     {Tokens: []TokenConfig{{Name: "a", Role: "admin", Token: "x"}}},
+		"missing name":           {Tokens: []TokenConfig{{Role: RoleRead, Token: "x"}}},
+		"repeated name":          {Tokens: []TokenConfig{{Name: "a", Role: RoleRead, Token: "x"}, {Name: "a", Role: RoleRead, Token: "y"}}},
+		"token and sha256":       {Tokens: []TokenConfig{{Name: "a", Role: RoleRead, Token: "x", SHA256: strings.Repeat("0", 64)}}},
+		"short sha256":           {Tokens: []TokenConfig{{Name: "a", Role: RoleRead, SHA256: "abcd"}}},
+		"same token twice":       {Tokens: []TokenConfig{{Name: "a", Role: RoleRead, Token: "x"}, {Name: "b", Role: RoleControl, Token: "x"}}},
+	} {
+		if _, err := NewAuth(cfg); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
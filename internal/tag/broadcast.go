@@ -0,0 +1,99 @@
+package tag
+
+import "sync"
+
+// Event is one published stream message; ID is the step it describes.
+type Event struct {
+	ID   int
+	Data []byte
+}
+
+// replayLen is how many recent events are kept for Last-Event-ID resumption.
+const replayLen = 64
+
+// subscriberBuffer is each subscriber's queue length; slow subscribers drop events.
+const subscriberBuffer = 16
+
+// Broadcaster fans published events out to any number of subscribers.
+type Broadcaster struct {
+	mu      sync.Mutex
+	subs    map[chan Event]struct{}
+	history []Event
+	closed  bool
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{subs: map[chan Event]struct{}{}}
+}
+
+// Publish sends e to every subscriber without blocking.
+func (b *Broadcaster) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.history = append(b.history, e)
+	if len(b.history) > replayLen {
+		b.history = b.history[len(b.history)-replayLen:]
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default: // drop frame if busy
+		}
+	}
+}
+
+// Subscribe returns a channel of events. Events newer than lastID that are still
+// in the replay window are delivered first; lastID 0 replays only the latest event.
+// cancel must be called when the subscriber goes away.
+func (b *Broadcaster) Subscribe(lastID int) (events <-chan Event, cancel func()) {
+	ch := make(chan Event, subscriberBuffer+replayLen)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	switch {
+	case lastID > 0:
+		for _, e := range b.history {
+			if e.ID > lastID {
+				ch <- e
+			}
+		}
+	case len(b.history) > 0:
+		ch <- b.history[len(b.history)-1]
+	}
+	b.subs[ch] = struct{}{}
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribers reports how many subscribers are attached.
+func (b *Broadcaster) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// Close ends every subscription; later publishes are ignored.
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,196 @@
+package tag
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// causalIndex assigns receipt IDs and resolves each new receipt's parents from
+// the latest receipts seen per (type, subject).
+type causalIndex struct {
+	next uint64
+	last map[string]uint64 // type + "/" + subject -> latest ID
+	hot  map[string]uint64 // error subject -> latest inject that carried error
+	// drain is the latest drain; backfeed subjects name the culprit, not the meta
+	drain uint64
+	// drainStep is the step of drain; a backfeed in any other step had
+	// nothing drained for it. Restores land between steps, so it is not saved.
+	drainStep int
+}
+
+func newCausalIndex() *causalIndex {
+	return &causalIndex{last: map[string]uint64{}, hot: map[string]uint64{}}
+}
+
+// clear forgets causes but keeps IDs counting, so they stay unique across resets.
+func (c *causalIndex) clear() {
+	c.last = map[string]uint64{}
+	c.hot = map[string]uint64{}
+	c.drain = 0
+}
+
+func (c *causalIndex) latest(t ReceiptType, subject string) uint64 {
+	return c.last[string(t)+"/"+subject]
+}
+
+// link stamps r with its ID and parents and records it.
+//
+// Resolution rules:
+//   - inject: the latest drive, observe, set, topology or backfeed that touched the origin bubble
+//   - diffuse: the inject of the same error
+//   - meta birth: every inject still carrying error
+//   - drain: the meta birth
+//   - backfeed: the drain that funded it, if that step drained anything
+//   - reconcile: the backfeed it settled, or for the field collapse the meta birth and last drain
+//   - late sample, stale input: the last accepted observation of the bubble
+func (c *causalIndex) link(r *Receipt) {
+	c.next++
+	r.ID = c.next
+	r.Parents = nil
+	add := func(id uint64) {
+		if id != 0 {
+			r.Parents = append(r.Parents, id)
+		}
+	}
+
+	switch r.Type {
+	case RInject:
+		bubble := strings.TrimSuffix(r.Subject, ".err")
+		var best uint64
+		for _, id := range []uint64{
+			c.latest(RDrive, bubble), c.latest(RObserve, bubble), c.latest(RSet, bubble),
+			c.latest(RTopology, bubble), c.latest(RBackfeed, r.Subject),
+		} {
+			best = max(best, id)
+		}
+		add(best)
+		if r.Payload != nil && r.Payload.After > 0 {
+			c.hot[r.Subject] = r.ID
+		} else {
+			delete(c.hot, r.Subject)
+		}
+	case RDiffuse:
+		add(c.latest(RInject, r.Subject))
+	case RMetaBirth:
+		for _, id := range c.hot {
+			add(id)
+		}
+		sort.Slice(r.Parents, func(i, j int) bool { return r.Parents[i] < r.Parents[j] })
+	case RDrain:
+		add(c.latest(RMetaBirth, r.Subject))
+	case RBackfeed:
+		if c.drainStep == r.Step {
+			add(c.drain)
+		}
+	case RReconcile:
+		if id := c.latest(RMetaBirth, r.Subject); id != 0 {
+			add(id)
+			add(c.drain)
+		} else {
+			add(c.latest(RBackfeed, r.Subject))
+		}
+	case RLate, RStale:
+		add(c.latest(RObserve, r.Subject))
+	}
+
+	c.last[string(r.Type)+"/"+r.Subject] = r.ID
+	if r.Type == RDrain {
+		c.drain, c.drainStep = r.ID, r.Step
+	}
+}
+
+// --- graph ---
+
+// CausalGraph indexes receipts by ID for walking causes and effects.
+type CausalGraph struct {
+	Nodes    []Receipt   `json:"nodes"`
+	Edges    [][2]uint64 `json:"edges"`             // parent -> child
+	Missing  []uint64    `json:"missing,omitempty"` // parents not in the log (trimmed or compacted)
+	byID     map[uint64]int
+	children map[uint64][]uint64
+}
+
+// NewCausalGraph builds the graph of a receipt log.
+func NewCausalGraph(rs []Receipt) *CausalGraph {
+	g := &CausalGraph{Nodes: rs, Edges: [][2]uint64{}, byID: map[uint64]int{}, children: map[uint64][]uint64{}}
+	for i, r := range rs {
+		g.byID[r.ID] = i
+	}
+	missing := map[uint64]bool{}
+	for _, r := range rs {
+		for _, p := range r.Parents {
+			g.Edges = append(g.Edges, [2]uint64{p, r.ID})
+			g.children[p] = append(g.children[p], r.ID)
+			if _, ok := g.byID[p]; !ok && !missing[p] {
+				missing[p] = true
+				g.Missing = append(g.Missing, p)
+			}
+		}
+	}
+	return g
+}
+
+// Receipt looks up a receipt by ID.
+func (g *CausalGraph) Receipt(id uint64) (Receipt, bool) {
+	i, ok := g.byID[id]
+	if !ok {
+		return Receipt{}, false
+	}
+	return g.Nodes[i], true
+}
+
+// Causes returns id and every receipt it transitively descends from, oldest first.
+func (g *CausalGraph) Causes(id uint64) *CausalGraph {
+	return g.walk(id, func(r Receipt) []uint64 { return r.Parents })
+}
+
+// Effects returns id and every receipt that transitively descends from it, oldest first.
+func (g *CausalGraph) Effects(id uint64) *CausalGraph {
+	return g.walk(id, func(r Receipt) []uint64 { return g.children[r.ID] })
+}
+
+func (g *CausalGraph) walk(id uint64, next func(Receipt) []uint64) *CausalGraph {
+	seen := map[uint64]bool{}
+	var out []Receipt
+	stack := []uint64{id}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		r, ok := g.Receipt(id)
+		if !ok {
+			continue
+		}
+		out = append(out, r)
+		stack = append(stack, next(r)...)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return NewCausalGraph(out)
+}
+
+// WriteDOT renders the graph for Graphviz.
+func (g *CausalGraph) WriteDOT(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, "digraph receipts {\n  rankdir=LR;\n  node [shape=box, fontsize=10];"); err != nil {
+		return err
+	}
+	for _, r := range g.Nodes {
+		label := fmt.Sprintf("#%d %s\n%s @%d", r.ID, r.Type, r.Subject, r.Step)
+		if p := r.Payload; p != nil {
+			label += fmt.Sprintf("\n%s %.4g→%.4g", p.Quantity, p.Before, p.After)
+		}
+		fmt.Fprintf(w, "  r%d [label=%q];\n", r.ID, label)
+	}
+	for _, id := range g.Missing {
+		fmt.Fprintf(w, "  r%d [label=\"#%d (not retained)\", style=dashed];\n", id, id)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(w, "  r%d -> r%d;\n", e[0], e[1])
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
@@ -0,0 +1,24 @@
+package tag
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBackfeedLinksOnlyToItsOwnDrain(t *testing.T) {
+	c := newCausalIndex()
+	rs := []Receipt{
+		{Step: 3, Type: RMetaBirth, Subject: "M"},
+		{Step: 3, Type: RDrain, Subject: "M"},
+		{Step: 3, Type: RBackfeed, Subject: "B.err"},
+		{Step: 4, Type: RBackfeed, Subject: "B.err"}, // step 4 drained nothing
+	}
+	for i := range rs {
+		c.link(&rs[i])
+	}
+	for i, want := range [][]uint64{nil, {1}, {2}, nil} {
+		if !reflect.DeepEqual(rs[i].Parents, want) {
+			t.Errorf("%s at step %d: parents %v, want %v", rs[i].Type, rs[i].Step, rs[i].Parents, want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package tag
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// HashReceipt is the chain hash of r: SHA-256 over its Prev followed by the JSON
+// encoding of every other field. r.Hash itself is ignored.
+func HashReceipt(r Receipt) string {
+	h := sha256.New()
+	h.Write([]byte(r.Prev))
+	r.Prev, r.Hash = "", ""
+	b, _ := json.Marshal(r)
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ChainError locates the first receipt that breaks a hash chain.
+type ChainError struct {
+	Index  int // position in the verified slice
+	Step   int
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("receipt %d (step %d): %s", e.Index, e.Step, e.Reason)
+}
+
+// VerifyChain checks an exported, hash-chained receipt log. An altered receipt
+// fails its own hash; a dropped or reordered one breaks the Prev link of its
+// successor. The first receipt's Prev anchors the log (it may follow receipts
+// the ledger no longer retains). If head is not empty the log must end there,
+// which also catches receipts dropped from the end.
+func VerifyChain(rs []Receipt, head string) error {
+	for i, r := range rs {
+		if r.Hash == "" {
+			return &ChainError{i, r.Step, "receipt is not chained"}
+		}
+		if HashReceipt(r) != r.Hash {
+			return &ChainError{i, r.Step, "hash mismatch (receipt altered)"}
+		}
+		if i > 0 && r.Prev != rs[i-1].Hash {
+			return &ChainError{i, r.Step, "prev does not match predecessor (receipt dropped or reordered)"}
+		}
+	}
+	if head != "" {
+		if n := len(rs); n == 0 || rs[n-1].Hash != head {
+			e := &ChainError{Index: n, Reason: "log does not end at head " + head}
+			if n > 0 {
+				e.Step = rs[n-1].Step
+			}
+			return e
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package tag
+
+import (
+	"errors"
+	"testing"
+)
+
+// chainedReceipts steps a hash-chained simulation and returns its log and head.
+func chainedReceipts(t *testing.T, ret Retention, steps int) ([]Receipt, string) {
+	t.Helper()
+	sim := NewSimulation()
+	if err := sim.SetRetention(ret); err != nil {
+		t.Fatal(err)
+	}
+	sim.SetHashChain(true)
+	for i := 0; i < steps; i++ {
+		sim.Step()
+	}
+	rs := sim.Snapshot().Receipts
+	for len(rs) > 0 && rs[0].Hash == "" {
+		rs = rs[1:]
+	}
+	_, head := sim.HashChain()
+	if len(rs) < 4 {
+		t.Fatalf("only %d chained receipts", len(rs))
+	}
+	return rs, head
+}
+
+func TestVerifyChain(t *testing.T) {
+	rs, head := chainedReceipts(t, DefaultRetention, 5)
+	if err := VerifyChain(rs, head); err != nil {
+		t.Fatalf("untouched log: %v", err)
+	}
+	edit := func(f func([]Receipt) []Receipt) []Receipt {
+		return f(append([]Receipt(nil), rs...))
+	}
+	for _, tc := range []struct {
+		name  string
+		log   []Receipt
+		head  string
+		index int
+	}{
+		{"altered note", edit(func(l []Receipt) []Receipt { l[2].Note += "!"; return l }), head, 2},
+		{"altered payload", edit(func(l []Receipt) []Receipt {
+			p := *l[1].Payload
+			p.After++
+			l[1].Payload = &p
+			return l
+		}), head, 1},
+		{"dropped receipt", edit(func(l []Receipt) []Receipt { return append(l[:2], l[3:]...) }), head, 2},
+		{"swapped receipts", edit(func(l []Receipt) []Receipt { l[1], l[2] = l[2], l[1]; return l }), head, 1},
+		{"dropped tail", rs[:len(rs)-1], head, len(rs) - 1},
+		{"unchained receipt", edit(func(l []Receipt) []Receipt { l[0].Hash = ""; return l }), "", 0},
+	} {
+		var ce *ChainError
+		if err := VerifyChain(tc.log, tc.head); !errors.As(err, &ce) || ce.Index != tc.index {
+			t.Errorf("%s: %v, want a break at %d", tc.name, err, tc.index)
+		}
+	}
+	// without a head a shortened log still verifies: it is only anchored at the front
+	if err := VerifyChain(rs[:len(rs)-1], ""); err != nil {
+		t.Errorf("prefix without head: %v", err)
+	}
+}
+
+func TestChainSurvivesRetention(t *testing.T) {
+	rs, head := chainedReceipts(t, Retention{MaxReceipts: 20}, 30)
+	if rs[0].Prev == "" {
+		t.Fatal("oldest retained receipt should link to a dropped one")
+	}
+	if err := VerifyChain(rs, head); err != nil {
+		t.Fatalf("trimmed log: %v", err)
+	}
+}
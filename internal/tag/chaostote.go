@@ -21,7 +21,7 @@ func (c *Chaostote) Diffuse(dt float64, receipts *[]Receipt, step int) {
 		e.ErrorValue *= decay
 		*receipts = append(*receipts, Receipt{
 			Step: step, Type: RDiffuse, Subject: e.ID,
-			Note: "chaostote diffusion", Value1: before, Value2: e.ErrorValue,
+			Note: "chaostote diffusion", Payload: change("error", before, e.ErrorValue),
 		})
 	}
 }
@@ -30,11 +30,12 @@ func (c *Chaostote) Diffuse(dt float64, receipts *[]Receipt, step int) {
 func (c *Chaostote) InjectChain(root *ErrorBubble, receipts *[]Receipt, step int) {
 	for e := root; e != nil; e = e.Downstream {
 		err := math.Max(0, math.Abs(e.Origin.State-e.Origin.Demand)-e.Origin.Tolerance)
+		before := e.ErrorValue
 		e.ErrorValue = err
 		c.Field = append(c.Field, e)
 		*receipts = append(*receipts, Receipt{
 			Step: step, Type: RInject, Subject: e.ID,
-			Note: "inject into chaostote", Value1: err,
+			Note: "inject into chaostote", Payload: change("error", before, err),
 		})
 	}
 }
@@ -62,8 +63,8 @@ func (c *Chaostote) CheckMetaBirth(limit float64, receipts *[]Receipt, step int)
 		}
 		*receipts = append(*receipts, Receipt{
 			Step: step, Type: RMetaBirth, Subject: meta.ID,
-			Note:   "chaostote exceeded limit; spawned meta totebubble",
-			Value1: total, Value2: limit,
+			Note:    "chaostote exceeded limit; spawned meta totebubble",
+			Payload: &Payload{Quantity: "total_error", After: total, Limit: limit},
 		})
 		return meta
 	}
@@ -0,0 +1,475 @@
+package tag
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// CheckpointVersion is bumped whenever the checkpoint layout changes incompatibly.
+const CheckpointVersion = 2
+
+const checkpointFormat = "tag-checkpoint"
+
+// Checkpoint is a complete, portable copy of a Simulation. The pointer graph is
+// flattened into tables: links are indices into Totes and Errors (-1 for nil).
+type Checkpoint struct {
+	Format  string    `json:"format"`
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+
+	Step       int     `json:"step"`
+	Time       float64 `json:"time"`
+	Params     Params  `json:"params"`
+	StaleAfter int     `json:"stale_after"`
+	Collapsed  bool    `json:"collapsed"`
+
+	Totes   []ToteRecord  `json:"totes"`
+	Errors  []ErrorRecord `json:"errors"`
+	Root    int           `json:"root"`
+	ErrRoot int           `json:"err_root"`
+	Meta    int           `json:"meta"`
+	Chi     ChiRecord     `json:"chi"`
+
+	Drivers []DriverRecord            `json:"drivers,omitempty"`
+	Pending []Observation             `json:"pending,omitempty"`
+	Tracks  map[string]TrackRecord    `json:"tracks,omitempty"`
+	History map[string][]BubbleSample `json:"history,omitempty"`
+	Ledger  LedgerRecord              `json:"ledger"`
+	Causal  CausalRecord              `json:"causal"`
+}
+
+type ToteRecord struct {
+	ID        string  `json:"id"`
+	Parent    int     `json:"parent"`
+	Child     int     `json:"child"`
+	State     float64 `json:"state"`
+	Demand    float64 `json:"demand"`
+	Tolerance float64 `json:"tolerance"`
+}
+
+type ErrorRecord struct {
+	ID         string  `json:"id"`
+	Origin     int     `json:"origin"`
+	Upstream   int     `json:"upstream"`
+	Downstream int     `json:"downstream"`
+	ErrorValue float64 `json:"error_value"`
+	IsCulprit  bool    `json:"is_culprit,omitempty"`
+	Resolved   bool    `json:"resolved,omitempty"`
+}
+
+type ChiRecord struct {
+	ID        string  `json:"id"`
+	Viscosity float64 `json:"viscosity"`
+	Field     []int   `json:"field"` // error indices, duplicates preserved
+}
+
+type DriverRecord struct {
+	Bubble string     `json:"bubble"`
+	Field  Field      `json:"field"`
+	Driver DriverSpec `json:"driver"`
+}
+
+type TrackRecord struct {
+	LastTS   time.Time `json:"last_ts"`
+	LastStep int       `json:"last_step"`
+	Stale    bool      `json:"stale,omitempty"`
+}
+
+type LedgerRecord struct {
+	Retention Retention          `json:"retention"`
+	Base      uint64             `json:"base"`
+	Seq       uint64             `json:"seq"`
+	Receipts  []Receipt          `json:"receipts"`
+	Diffuse   map[string]float64 `json:"diffuse,omitempty"`
+	Chained   bool               `json:"chained,omitempty"`
+	Head      string             `json:"head,omitempty"`
+}
+
+// CausalRecord is the receipt ID counter and causal index.
+type CausalRecord struct {
+	Next  uint64            `json:"next"`
+	Last  map[string]uint64 `json:"last,omitempty"`
+	Hot   map[string]uint64 `json:"hot,omitempty"`
+	Drain uint64            `json:"drain,omitempty"`
+}
+
+// --- save ---
+
+// Checkpoint captures the full simulation state. It fails only when a bound
+// driver is not one of the built-in, encodable kinds.
+func (s *Simulation) Checkpoint() (*Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.checkpoint()
+}
+
+func (s *Simulation) checkpoint() (*Checkpoint, error) {
+	cp := &Checkpoint{
+		Format: checkpointFormat, Version: CheckpointVersion, Created: time.Now().UTC(),
+		Step: s.StepNum, Time: s.Time, Params: s.ParamsCfg, StaleAfter: s.StaleAfter, Collapsed: s.collapsed,
+		Root: -1, ErrRoot: -1, Meta: -1,
+	}
+
+	totes := map[*ToteBubble]int{}
+	var addTote func(t *ToteBubble) int
+	addTote = func(t *ToteBubble) int {
+		if t == nil {
+			return -1
+		}
+		if i, ok := totes[t]; ok {
+			return i
+		}
+		i := len(cp.Totes)
+		totes[t] = i
+		cp.Totes = append(cp.Totes, ToteRecord{ID: t.ID, State: t.State, Demand: t.Demand, Tolerance: t.Tolerance})
+		p, c := addTote(t.Parent), addTote(t.Child)
+		cp.Totes[i].Parent, cp.Totes[i].Child = p, c
+		return i
+	}
+	errs := map[*ErrorBubble]int{}
+	var addErr func(e *ErrorBubble) int
+	addErr = func(e *ErrorBubble) int {
+		if e == nil {
+			return -1
+		}
+		if i, ok := errs[e]; ok {
+			return i
+		}
+		i := len(cp.Errors)
+		errs[e] = i
+		cp.Errors = append(cp.Errors, ErrorRecord{ID: e.ID, ErrorValue: e.ErrorValue, IsCulprit: e.IsCulprit, Resolved: e.Resolved})
+		o, u, d := addTote(e.Origin), addErr(e.Upstream), addErr(e.Downstream)
+		cp.Errors[i].Origin, cp.Errors[i].Upstream, cp.Errors[i].Downstream = o, u, d
+		return i
+	}
+
+	cp.Root = addTote(s.Root)
+	cp.Meta = addTote(s.Meta)
+	cp.ErrRoot = addErr(s.ErrRoot)
+	cp.Chi = ChiRecord{ID: s.Chi.ID, Viscosity: s.Chi.Viscosity, Field: make([]int, len(s.Chi.Field))}
+	for i, e := range s.Chi.Field {
+		cp.Chi.Field[i] = addErr(e)
+	}
+
+	for _, b := range s.Drivers {
+		spec, err := EncodeDriver(b.Driver)
+		if err != nil {
+			return nil, fmt.Errorf("checkpoint driver on %s.%s: %w", b.Bubble, b.Field, err)
+		}
+		cp.Drivers = append(cp.Drivers, DriverRecord{Bubble: b.Bubble, Field: b.Field, Driver: spec})
+	}
+	cp.Pending = append([]Observation(nil), s.pending...)
+	cp.Tracks = map[string]TrackRecord{}
+	for id, tr := range s.tracks {
+		cp.Tracks[id] = TrackRecord{LastTS: tr.lastTS, LastStep: tr.lastStep, Stale: tr.stale}
+	}
+	cp.History = map[string][]BubbleSample{}
+	for id, h := range s.history {
+		cp.History[id] = append([]BubbleSample(nil), h...)
+	}
+
+	l := s.Ledger
+	cp.Ledger = LedgerRecord{Retention: l.ret, Base: l.base, Seq: l.seq, Receipts: l.All(), Diffuse: map[string]float64{},
+		Chained: l.chained, Head: l.head}
+	for k, v := range l.diffuse {
+		cp.Ledger.Diffuse[k] = v
+	}
+	c := s.causes
+	cp.Causal = CausalRecord{Next: c.next, Last: map[string]uint64{}, Hot: map[string]uint64{}, Drain: c.drain}
+	for k, v := range c.last {
+		cp.Causal.Last[k] = v
+	}
+	for k, v := range c.hot {
+		cp.Causal.Hot[k] = v
+	}
+	return cp, nil
+}
+
+// WriteTo encodes the checkpoint as JSON.
+func (cp *Checkpoint) WriteTo(w io.Writer) (int64, error) {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(b, '\n'))
+	return int64(n), err
+}
+
+// SaveCheckpoint writes a checkpoint file.
+func SaveCheckpoint(path string, cp *Checkpoint) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := cp.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// --- load ---
+
+// ReadCheckpoint decodes and checks a checkpoint. A signed checkpoint envelope
+// is accepted too; its signature is checked against the embedded key.
+func ReadCheckpoint(r io.Reader) (*Checkpoint, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+	var env Envelope
+	if json.Unmarshal(raw, &env) == nil && env.Kind == KindCheckpoint && env.Sig != "" {
+		if err := env.Verify(nil); err != nil {
+			return nil, fmt.Errorf("signed checkpoint: %w", err)
+		}
+		raw = env.Payload
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(raw, &cp); err != nil {
+		return nil, err
+	}
+	if cp.Format != checkpointFormat {
+		return nil, fmt.Errorf("not a TAG checkpoint (format %q)", cp.Format)
+	}
+	if cp.Version != CheckpointVersion {
+		return nil, fmt.Errorf("checkpoint version %d not supported (want %d)", cp.Version, CheckpointVersion)
+	}
+	return &cp, nil
+}
+
+// LoadCheckpoint reads a checkpoint file.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadCheckpoint(f)
+}
+
+// FromCheckpoint builds a new simulation from a checkpoint. Like
+// NewSimulation, it keeps rewind points at the default interval.
+func FromCheckpoint(cp *Checkpoint) (*Simulation, error) {
+	s := &Simulation{tt: &timeline{every: DefaultRewindEvery, keep: DefaultRewindKeep}}
+	install, err := s.prepareRestore(cp)
+	if err != nil {
+		return nil, err
+	}
+	install()
+	s.tt.restart(s)
+	s.unsent = nil
+	return s, nil
+}
+
+// Restore replaces the simulation's state with a checkpoint in place.
+// Observers, the clock and the journal stay attached.
+func (s *Simulation) Restore(cp *Checkpoint) error {
+	s.mu.Lock()
+	defer s.unlock()
+	install, err := s.prepareRestore(cp)
+	if err != nil {
+		return err
+	}
+	if err := s.journalOp(OpRestore, cp); err != nil {
+		return err
+	}
+	install()
+	if s.tt != nil {
+		s.tt.restart(s)
+	}
+	return nil
+}
+
+// prepareRestore decodes and checks cp without touching s; install swaps
+// the result in. Callers hold s.mu throughout.
+func (s *Simulation) prepareRestore(cp *Checkpoint) (install func(), err error) {
+	// the same ranges the live setters enforce
+	if err := cp.Params.Validate(); err != nil {
+		return nil, fmt.Errorf("checkpoint params: %w", err)
+	}
+	if err := paramRanges["viscosity"].check("viscosity", cp.Chi.Viscosity); err != nil {
+		return nil, fmt.Errorf("checkpoint chaostote: %w", err)
+	}
+	if err := cp.Ledger.Retention.Validate(); err != nil {
+		return nil, fmt.Errorf("checkpoint: %w", err)
+	}
+	if cp.StaleAfter < 0 {
+		return nil, fmt.Errorf("checkpoint: stale_after must be >= 0")
+	}
+	totes := make([]*ToteBubble, len(cp.Totes))
+	for i, r := range cp.Totes {
+		if err := validValues(&r.State, &r.Demand, &r.Tolerance); err != nil {
+			return nil, fmt.Errorf("checkpoint bubble %q: %w", r.ID, err)
+		}
+		totes[i] = &ToteBubble{ID: r.ID, State: r.State, Demand: r.Demand, Tolerance: r.Tolerance}
+	}
+	errs := make([]*ErrorBubble, len(cp.Errors))
+	for i, r := range cp.Errors {
+		if math.IsNaN(r.ErrorValue) || math.IsInf(r.ErrorValue, 0) {
+			return nil, fmt.Errorf("checkpoint error bubble %q: error must be finite", r.ID)
+		}
+		errs[i] = &ErrorBubble{ID: r.ID, ErrorValue: r.ErrorValue, IsCulprit: r.IsCulprit, Resolved: r.Resolved}
+	}
+	var bad error
+	tote := func(i int) *ToteBubble {
+		if i < -1 || i >= len(totes) {
+			bad = fmt.Errorf("checkpoint: tote index %d out of range", i)
+			return nil
+		}
+		if i < 0 {
+			return nil
+		}
+		return totes[i]
+	}
+	errAt := func(i int) *ErrorBubble {
+		if i < -1 || i >= len(errs) {
+			bad = fmt.Errorf("checkpoint: error index %d out of range", i)
+			return nil
+		}
+		if i < 0 {
+			return nil
+		}
+		return errs[i]
+	}
+	for i, r := range cp.Totes {
+		totes[i].Parent, totes[i].Child = tote(r.Parent), tote(r.Child)
+	}
+	for i, r := range cp.Errors {
+		errs[i].Origin, errs[i].Upstream, errs[i].Downstream = tote(r.Origin), errAt(r.Upstream), errAt(r.Downstream)
+	}
+	field := make([]*ErrorBubble, len(cp.Chi.Field))
+	for i, idx := range cp.Chi.Field {
+		field[i] = errAt(idx)
+	}
+	root, errRoot, meta := tote(cp.Root), errAt(cp.ErrRoot), tote(cp.Meta)
+	if bad != nil {
+		return nil, bad
+	}
+	if root == nil {
+		return nil, fmt.Errorf("checkpoint has no root bubble")
+	}
+	if err := checkLinks(totes, errs, root, errRoot, meta, field); err != nil {
+		return nil, err
+	}
+	drivers := make([]Binding, 0, len(cp.Drivers))
+	for _, d := range cp.Drivers {
+		if findBubble(root, d.Bubble) == nil {
+			return nil, fmt.Errorf("checkpoint: driver on unknown bubble %q", d.Bubble)
+		}
+		if d.Field != FieldState && d.Field != FieldDemand {
+			return nil, fmt.Errorf("checkpoint: driver on unknown field %q", d.Field)
+		}
+		drv, err := d.Driver.Driver()
+		if err != nil {
+			return nil, err
+		}
+		drivers = append(drivers, Binding{Bubble: d.Bubble, Field: d.Field, Driver: drv})
+	}
+	l := NewLedger(cp.Ledger.Retention)
+	l.entries = append([]Receipt(nil), cp.Ledger.Receipts...)
+	l.base, l.seq = cp.Ledger.Base, cp.Ledger.Seq
+	l.chained, l.head = cp.Ledger.Chained, cp.Ledger.Head
+	if l.base+uint64(len(l.entries)) != l.seq {
+		return nil, fmt.Errorf("checkpoint ledger holds %d receipts but spans %d..%d", len(l.entries), l.base, l.seq)
+	}
+	for k, v := range cp.Ledger.Diffuse {
+		l.diffuse[k] = v
+	}
+	if s.Ledger != nil && s.Ledger.seq > l.base {
+		// restoring in place: keep sequence numbers counting so stream cursors stay unique
+		l.base, l.seq = s.Ledger.seq, s.Ledger.seq+uint64(len(l.entries))
+	}
+	causes := newCausalIndex()
+	causes.next, causes.drain = cp.Causal.Next, cp.Causal.Drain
+	for k, v := range cp.Causal.Last {
+		causes.last[k] = v
+	}
+	for k, v := range cp.Causal.Hot {
+		causes.hot[k] = v
+	}
+
+	// everything checked out; nothing above touched s
+	return func() {
+		s.StepNum, s.Time, s.ParamsCfg = cp.Step, cp.Time, cp.Params
+		s.StaleAfter, s.collapsed = cp.StaleAfter, cp.Collapsed
+		s.Root, s.ErrRoot, s.Meta = root, errRoot, meta
+		s.Chi = &Chaostote{ID: cp.Chi.ID, Viscosity: cp.Chi.Viscosity, Field: field}
+		s.Drivers = drivers
+		s.pending = append([]Observation(nil), cp.Pending...)
+		s.tracks = map[string]*ingestTrack{}
+		for id, tr := range cp.Tracks {
+			s.tracks[id] = &ingestTrack{lastTS: tr.LastTS, lastStep: tr.LastStep, stale: tr.Stale}
+		}
+		s.history = map[string][]BubbleSample{}
+		for id, h := range cp.History {
+			s.history[id] = append([]BubbleSample(nil), h...)
+		}
+		s.Ledger = l
+		s.causes = causes
+	}, nil
+}
+
+// checkLinks rejects pointer graphs a step would trip over. Parent/Child and
+// Upstream/Downstream must mirror each other, so every bubble lies on one
+// list; a list with no head is a cycle. Every error needs an origin.
+func checkLinks(totes []*ToteBubble, errs []*ErrorBubble, root *ToteBubble, errRoot *ErrorBubble, meta *ToteBubble, field []*ErrorBubble) error {
+	for _, t := range totes {
+		if t.Child != nil && t.Child.Parent != t || t.Parent != nil && t.Parent.Child != t {
+			return fmt.Errorf("checkpoint: tote %q: parent and child links do not mirror", t.ID)
+		}
+	}
+	onList := map[*ToteBubble]bool{}
+	for _, t := range totes {
+		if t.Parent == nil {
+			for c := t; c != nil; c = c.Child {
+				onList[c] = true
+			}
+		}
+	}
+	for _, t := range totes {
+		if !onList[t] {
+			return fmt.Errorf("checkpoint: tote %q is on a parent/child cycle", t.ID)
+		}
+	}
+	if root.Parent != nil {
+		return fmt.Errorf("checkpoint: root %q has a parent", root.ID)
+	}
+	if meta != nil && (meta == root || meta.Parent != nil || meta.Child != nil) {
+		return fmt.Errorf("checkpoint: meta %q must stand alone", meta.ID)
+	}
+
+	for _, e := range errs {
+		if e.Origin == nil {
+			return fmt.Errorf("checkpoint: error %q has no origin", e.ID)
+		}
+		if e.Downstream != nil && e.Downstream.Upstream != e || e.Upstream != nil && e.Upstream.Downstream != e {
+			return fmt.Errorf("checkpoint: error %q: upstream and downstream links do not mirror", e.ID)
+		}
+	}
+	onErrList := map[*ErrorBubble]bool{}
+	for _, e := range errs {
+		if e.Upstream == nil {
+			for c := e; c != nil; c = c.Downstream {
+				onErrList[c] = true
+			}
+		}
+	}
+	for _, e := range errs {
+		if !onErrList[e] {
+			return fmt.Errorf("checkpoint: error %q is on an upstream/downstream cycle", e.ID)
+		}
+	}
+	if errRoot != nil && errRoot.Upstream != nil {
+		return fmt.Errorf("checkpoint: error root %q has an upstream", errRoot.ID)
+	}
+	for i, e := range field {
+		if e == nil {
+			return fmt.Errorf("checkpoint: chaostote field entry %d is empty", i)
+		}
+	}
+	return nil
+}
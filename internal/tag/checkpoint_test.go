@@ -0,0 +1,103 @@
+package tag
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+// sameState compares two simulations by their checkpoints, ignoring when
+// each was taken.
+func sameState(t *testing.T, a, b *Simulation) {
+	t.Helper()
+	enc := func(s *Simulation) string {
+		cp, err := s.Checkpoint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cp.Created = time.Time{}
+		raw, _ := json.Marshal(cp)
+		return string(raw)
+	}
+	if ea, eb := enc(a), enc(b); ea != eb {
+		t.Fatalf("simulations differ:\n%s\n%s", ea, eb)
+	}
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	src := NewSimulation()
+	src.SetHashChain(true)
+	if err := src.Attach("B", FieldDemand, Sine{Offset: 1.6, Amplitude: 0.2, Period: 8}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		src.Step()
+	}
+	cp, err := src.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := cp.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	back, err := ReadCheckpoint(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := FromCheckpoint(back)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameState(t, src, dst)
+
+	// restored simulations carry on exactly as the original does
+	for i := 0; i < 30; i++ {
+		src.Step()
+		dst.Step()
+	}
+	sameState(t, src, dst)
+	rs := dst.Snapshot().Receipts
+	for len(rs) > 0 && rs[0].Hash == "" {
+		rs = rs[1:] // written before chaining was turned on
+	}
+	if err := VerifyChain(rs, dst.Ledger.Head()); err != nil {
+		t.Fatalf("restored hash chain: %v", err)
+	}
+}
+
+func TestRestoreRejectsOutOfRange(t *testing.T) {
+	for name, spoil := range map[string]func(*Checkpoint){
+		"negative viscosity":  func(cp *Checkpoint) { cp.Params.Viscosity = -1 },
+		"zero dt":             func(cp *Checkpoint) { cp.Params.Dt = 0 },
+		"huge limit":          func(cp *Checkpoint) { cp.Params.Limit = 1e9 },
+		"chaostote viscosity": func(cp *Checkpoint) { cp.Chi.Viscosity = 2 },
+		"negative retention":  func(cp *Checkpoint) { cp.Ledger.Retention.MaxReceipts = -1 },
+		"NaN compaction":      func(cp *Checkpoint) { cp.Ledger.Retention.CompactEpsilon = math.NaN() },
+		"negative stale":      func(cp *Checkpoint) { cp.StaleAfter = -1 },
+		"NaN state":           func(cp *Checkpoint) { cp.Totes[0].State = math.NaN() },
+		"infinite demand":     func(cp *Checkpoint) { cp.Totes[0].Demand = math.Inf(1) },
+		"negative tolerance":  func(cp *Checkpoint) { cp.Totes[0].Tolerance = -0.1 },
+		"NaN error":           func(cp *Checkpoint) { cp.Errors[0].ErrorValue = math.NaN() },
+	} {
+		sim := NewSimulation()
+		sim.Step()
+		cp, err := sim.Checkpoint()
+		if err != nil {
+			t.Fatal(err)
+		}
+		before := sim.State()
+		spoil(cp)
+		if err := sim.Restore(cp); err == nil {
+			t.Errorf("%s: restored", name)
+		}
+		if _, err := FromCheckpoint(cp); err == nil {
+			t.Errorf("%s: built a simulation", name)
+		}
+		if after := sim.State(); after.Step != before.Step || after.TotalError != before.TotalError {
+			t.Errorf("%s: failed restore changed the simulation", name)
+		}
+	}
+}
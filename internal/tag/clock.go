@@ -0,0 +1,238 @@
+package tag
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	physicsHz = 30                     // base physics rate
+	sendEvery = 200 * time.Millisecond // 5 Hz output
+	maxSpeed  = 100.0
+	maxRateHz = 1000.0
+)
+
+// ClockRates sets how often a Clock steps at speed 1 and how often it
+// publishes to streams. Zero fields mean the defaults.
+type ClockRates struct {
+	PhysicsHz float64 `json:"physics_hz"`
+	SendHz    float64 `json:"send_hz"`
+}
+
+// DefaultClockRates are 30 steps and 5 stream ticks a second.
+var DefaultClockRates = ClockRates{PhysicsHz: physicsHz, SendHz: float64(time.Second / sendEvery)}
+
+// resolve fills zero fields with the defaults and checks the result.
+func (r ClockRates) resolve() (ClockRates, error) {
+	if r.PhysicsHz == 0 {
+		r.PhysicsHz = DefaultClockRates.PhysicsHz
+	}
+	if r.SendHz == 0 {
+		r.SendHz = DefaultClockRates.SendHz
+	}
+	for _, hz := range []float64{r.PhysicsHz, r.SendHz} {
+		if math.IsNaN(hz) || hz <= 0 || hz > maxRateHz {
+			return r, fmt.Errorf("clock rates must be in (0, %g] Hz", maxRateHz)
+		}
+	}
+	return r, nil
+}
+
+func hzPeriod(hz float64) time.Duration { return time.Duration(float64(time.Second) / hz) }
+
+// ClockStatus is the JSON view of a Clock.
+type ClockStatus struct {
+	Running     bool       `json:"running"`
+	Paused      bool       `json:"paused"`
+	Speed       float64    `json:"speed"`
+	Idle        bool       `json:"idle"`
+	Subscribers int        `json:"subscribers"`
+	Rates       ClockRates `json:"rates"`
+}
+
+// ClockUpdate changes any subset of a Clock's controls.
+type ClockUpdate struct {
+	Paused *bool    `json:"paused,omitempty"`
+	Speed  *float64 `json:"speed,omitempty"`
+}
+
+// Model is what a Clock drives. A Simulation is one; internal/engine adapts
+// its other engines.
+type Model interface {
+	Step()
+	// Idle reports whether stepping would change nothing; idle models are not stepped.
+	Idle() bool
+	// Tick describes the model for subscribers. The Clock publishes ev
+	// whenever key differs from the key of the last published tick.
+	Tick() (ev Event, key any)
+}
+
+// Clock is the single physics loop of one Model. It steps at 30 Hz times
+// Speed and, at 5 Hz, publishes a Tick to its Broadcaster whenever anything
+// changed. Stream clients treat each event as a tick and build their own
+// delta frames.
+type Clock struct {
+	m Model
+	B *Broadcaster
+
+	mu      sync.Mutex
+	running bool
+	paused  bool
+	speed   float64
+	rates   ClockRates
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// Clock returns the simulation's clock, creating it on first use.
+func (s *Simulation) Clock() *Clock {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clock == nil {
+		s.clock = NewClock(s)
+	}
+	return s.clock
+}
+
+// NewClock returns a stopped clock for m at the default rates.
+func NewClock(m Model) *Clock {
+	return &Clock{m: m, B: NewBroadcaster(), speed: 1, rates: DefaultClockRates}
+}
+
+// Start launches the loop if it is not already running.
+func (c *Clock) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running {
+		return
+	}
+	c.running = true
+	c.stop = make(chan struct{})
+	c.done = make(chan struct{})
+	go c.loop(c.stop, c.done, c.rates)
+}
+
+// SetRates changes the step and publish rates, restarting a running loop.
+func (c *Clock) SetRates(r ClockRates) error {
+	r, err := r.resolve()
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.rates = r
+	running := c.running
+	c.mu.Unlock()
+	if running {
+		c.Stop()
+		c.Start()
+	}
+	return nil
+}
+
+// Stop halts the loop and waits for it to exit. Subscribers stay attached.
+func (c *Clock) Stop() {
+	c.mu.Lock()
+	if !c.running {
+		c.mu.Unlock()
+		return
+	}
+	c.running = false
+	close(c.stop)
+	done := c.done
+	c.mu.Unlock()
+	<-done
+}
+
+// Close stops the loop and ends every subscription.
+func (c *Clock) Close() {
+	c.Stop()
+	c.B.Close()
+}
+
+// Update applies pause/speed changes.
+func (c *Clock) Update(u ClockUpdate) error {
+	if u.Speed != nil && (math.IsNaN(*u.Speed) || *u.Speed <= 0 || *u.Speed > maxSpeed) {
+		return fmt.Errorf("speed must be in (0, %g]", maxSpeed)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if u.Paused != nil {
+		c.paused = *u.Paused
+	}
+	if u.Speed != nil {
+		c.speed = *u.Speed
+	}
+	return nil
+}
+
+func (c *Clock) Status() ClockStatus {
+	c.mu.Lock()
+	st := ClockStatus{Running: c.running, Paused: c.paused, Speed: c.speed, Rates: c.rates}
+	c.mu.Unlock()
+	st.Idle = c.m.Idle()
+	st.Subscribers = c.B.Subscribers()
+	return st
+}
+
+// Subscribe starts the clock if needed and attaches a subscriber.
+func (c *Clock) Subscribe(lastID int) (<-chan Event, func()) {
+	c.Start()
+	return c.B.Subscribe(lastID)
+}
+
+func (c *Clock) loop(stop <-chan struct{}, done chan<- struct{}, rates ClockRates) {
+	defer close(done)
+	physTicker := time.NewTicker(hzPeriod(rates.PhysicsHz))
+	sendTicker := time.NewTicker(hzPeriod(rates.SendHz))
+	defer physTicker.Stop()
+	defer sendTicker.Stop()
+
+	var acc float64 // fractional steps owed at the current speed
+	var lastKey any
+	for {
+		select {
+		case <-stop:
+			return
+
+		case <-physTicker.C:
+			c.mu.Lock()
+			paused, speed := c.paused, c.speed
+			c.mu.Unlock()
+			if paused || c.m.Idle() {
+				acc = 0
+				continue
+			}
+			for acc += speed; acc >= 1; acc-- {
+				c.m.Step()
+			}
+
+		case <-sendTicker.C:
+			// Only send if something actually changed
+			if ev, key := c.m.Tick(); key != lastKey {
+				c.B.Publish(ev)
+				lastKey = key
+			}
+		}
+	}
+}
+
+// tickKey changes whenever a stream client would see something new.
+type tickKey struct {
+	step        int
+	seq         uint64
+	total, meta float64 // in units of 1e-5
+	journalErr  string
+}
+
+// Tick is the receipt-free SimState the clock streams.
+func (s *Simulation) Tick() (Event, any) {
+	s.mu.Lock()
+	state, seq := s.state(), s.Ledger.Seq()
+	s.mu.Unlock()
+	b, _ := json.Marshal(state)
+	key := tickKey{state.Step, seq, math.Round(state.TotalError * 1e5), math.Round(state.MetaEnergy * 1e5), state.JournalError}
+	return Event{ID: state.Step, Data: b}, key
+}
@@ -0,0 +1,345 @@
+package tag
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Driver produces an external input for a ToteBubble field.
+// It is evaluated once per step with the step number and simulated time.
+type Driver interface {
+	Value(step int, t float64) float64
+}
+
+// DriverFunc adapts a plain function to the Driver interface.
+type DriverFunc func(step int, t float64) float64
+
+func (f DriverFunc) Value(step int, t float64) float64 { return f(step, t) }
+
+// Validator is implemented by drivers whose fields can be out of range.
+// Attach and DriverSpec.Driver refuse a driver that fails Validate.
+type Validator interface {
+	Validate() error
+}
+
+func validateDriver(d Driver) error {
+	if v, ok := d.(Validator); ok {
+		return v.Validate()
+	}
+	return nil
+}
+
+// Field names a driven ToteBubble quantity.
+type Field string
+
+const (
+	FieldState  Field = "state"
+	FieldDemand Field = "demand"
+)
+
+// Binding attaches a Driver to one field of one bubble.
+type Binding struct {
+	Bubble string
+	Field  Field
+	Driver Driver
+}
+
+// --- waveforms ---
+
+// Constant holds a fixed value.
+type Constant struct {
+	V float64
+}
+
+func (c Constant) Value(int, float64) float64 { return c.V }
+
+// StepChange jumps from Before to After at time At.
+type StepChange struct {
+	Before, After float64
+	At            float64
+}
+
+func (s StepChange) Value(_ int, t float64) float64 {
+	if t < s.At {
+		return s.Before
+	}
+	return s.After
+}
+
+// Ramp moves linearly from From to To between Start and End.
+type Ramp struct {
+	From, To   float64
+	Start, End float64
+}
+
+func (r Ramp) Value(_ int, t float64) float64 {
+	switch {
+	case t <= r.Start:
+		return r.From
+	case t >= r.End || r.End <= r.Start:
+		return r.To
+	}
+	return r.From + (r.To-r.From)*(t-r.Start)/(r.End-r.Start)
+}
+
+// Sine oscillates around Offset.
+type Sine struct {
+	Offset, Amplitude float64
+	Period, Phase     float64
+}
+
+func (s Sine) Value(_ int, t float64) float64 {
+	if s.Period <= 0 {
+		return s.Offset
+	}
+	return s.Offset + s.Amplitude*math.Sin(2*math.Pi*t/s.Period+s.Phase)
+}
+
+// Square alternates between High and Low; Duty, in [0, 1], is the fraction
+// of each Period spent high, so the zero Duty holds Low.
+type Square struct {
+	Low, High    float64
+	Period, Duty float64
+}
+
+func (s Square) Validate() error {
+	if !(s.Duty >= 0 && s.Duty <= 1) {
+		return fmt.Errorf("square duty must be in [0, 1], got %g", s.Duty)
+	}
+	return nil
+}
+
+func (s Square) Value(_ int, t float64) float64 {
+	if s.Period <= 0 {
+		return s.Low
+	}
+	phase := math.Mod(t, s.Period) / s.Period
+	if phase < 0 {
+		phase++
+	}
+	if phase < s.Duty {
+		return s.High
+	}
+	return s.Low
+}
+
+// --- tables ---
+
+// Point is one (time, value) sample.
+type Point struct {
+	T float64 `json:"t"`
+	V float64 `json:"v"`
+}
+
+// Piecewise interpolates linearly between points sorted by time.
+// Outside the table the first or last value is held.
+type Piecewise struct {
+	Points []Point
+}
+
+func (p Piecewise) Validate() error { return checkPoints("piecewise", p.Points) }
+
+func (p Piecewise) Value(_ int, t float64) float64 {
+	n := len(p.Points)
+	if n == 0 {
+		return 0
+	}
+	i := sort.Search(n, func(i int) bool { return p.Points[i].T > t })
+	if i == 0 {
+		return p.Points[0].V
+	}
+	if i == n {
+		return p.Points[n-1].V
+	}
+	a, b := p.Points[i-1], p.Points[i]
+	return a.V + (b.V-a.V)*(t-a.T)/(b.T-a.T)
+}
+
+// Series replays recorded samples, holding each value until the next sample.
+type Series struct {
+	Points []Point
+}
+
+func (s Series) Validate() error { return checkPoints("series", s.Points) }
+
+// checkPoints requires strictly increasing times, as the lookups assume.
+func checkPoints(kind string, ps []Point) error {
+	for i := 1; i < len(ps); i++ {
+		if !(ps[i].T > ps[i-1].T) {
+			return fmt.Errorf("%s point %d: time %g does not follow %g", kind, i, ps[i].T, ps[i-1].T)
+		}
+	}
+	return nil
+}
+
+func (s Series) Value(_ int, t float64) float64 {
+	n := len(s.Points)
+	if n == 0 {
+		return 0
+	}
+	i := sort.Search(n, func(i int) bool { return s.Points[i].T > t })
+	if i == 0 {
+		return s.Points[0].V
+	}
+	return s.Points[i-1].V
+}
+
+// ReadSeriesCSV parses "time,value" rows into a Series.
+// A non-numeric first row is treated as a header.
+func ReadSeriesCSV(r io.Reader) (*Series, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	s := &Series{}
+	for i, row := range rows {
+		if len(row) < 2 {
+			return nil, fmt.Errorf("series row %d: want time,value", i+1)
+		}
+		t, errT := strconv.ParseFloat(strings.TrimSpace(row[0]), 64)
+		v, errV := strconv.ParseFloat(strings.TrimSpace(row[1]), 64)
+		if errT != nil || errV != nil {
+			if i == 0 {
+				continue // header
+			}
+			return nil, fmt.Errorf("series row %d: %q is not numeric", i+1, strings.Join(row, ","))
+		}
+		s.Points = append(s.Points, Point{T: t, V: v})
+	}
+	sort.SliceStable(s.Points, func(i, j int) bool { return s.Points[i].T < s.Points[j].T })
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LoadSeriesCSV reads a Series from a CSV file on disk.
+func LoadSeriesCSV(path string) (*Series, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSeriesCSV(f)
+}
+
+// --- application ---
+
+// applyDrivers evaluates every binding and records a receipt for each change.
+func applyDrivers(root *ToteBubble, bindings []Binding, step int, t float64, receipts *[]Receipt) {
+	for _, b := range bindings {
+		tb := findBubble(root, b.Bubble)
+		if tb == nil {
+			continue
+		}
+		v := b.Driver.Value(step, t)
+		ptr := fieldPtr(tb, b.Field)
+		if ptr == nil || *ptr == v {
+			continue
+		}
+		before := *ptr
+		*ptr = v
+		*receipts = append(*receipts, Receipt{
+			Step: step, Type: RDrive, Subject: tb.ID,
+			Note: "driver set " + string(b.Field), Payload: change(string(b.Field), before, v),
+		})
+	}
+}
+
+func fieldPtr(tb *ToteBubble, f Field) *float64 {
+	switch f {
+	case FieldState:
+		return &tb.State
+	case FieldDemand:
+		return &tb.Demand
+	}
+	return nil
+}
+
+// --- encoding ---
+
+// DriverSpec is the JSON form of the built-in drivers.
+type DriverSpec struct {
+	Kind string `json:"kind"` // constant, step, ramp, sine, square, piecewise, series
+
+	Value     float64 `json:"value,omitempty"`
+	Before    float64 `json:"before,omitempty"`
+	After     float64 `json:"after,omitempty"`
+	At        float64 `json:"at,omitempty"`
+	From      float64 `json:"from,omitempty"`
+	To        float64 `json:"to,omitempty"`
+	Start     float64 `json:"start,omitempty"`
+	End       float64 `json:"end,omitempty"`
+	Offset    float64 `json:"offset,omitempty"`
+	Amplitude float64 `json:"amplitude,omitempty"`
+	Period    float64 `json:"period,omitempty"`
+	Phase     float64 `json:"phase,omitempty"`
+	Low       float64 `json:"low,omitempty"`
+	High      float64 `json:"high,omitempty"`
+	Duty      float64 `json:"duty,omitempty"` // square; 0 when unset, as in Square{}
+	Points    []Point `json:"points,omitempty"`
+}
+
+// EncodeDriver describes a built-in driver; custom drivers cannot be encoded.
+func EncodeDriver(d Driver) (DriverSpec, error) {
+	switch d := d.(type) {
+	case Constant:
+		return DriverSpec{Kind: "constant", Value: d.V}, nil
+	case StepChange:
+		return DriverSpec{Kind: "step", Before: d.Before, After: d.After, At: d.At}, nil
+	case Ramp:
+		return DriverSpec{Kind: "ramp", From: d.From, To: d.To, Start: d.Start, End: d.End}, nil
+	case Sine:
+		return DriverSpec{Kind: "sine", Offset: d.Offset, Amplitude: d.Amplitude, Period: d.Period, Phase: d.Phase}, nil
+	case Square:
+		return DriverSpec{Kind: "square", Low: d.Low, High: d.High, Period: d.Period, Duty: d.Duty}, nil
+	case Piecewise:
+		return DriverSpec{Kind: "piecewise", Points: d.Points}, nil
+	case Series:
+		return DriverSpec{Kind: "series", Points: d.Points}, nil
+	case *Series:
+		return DriverSpec{Kind: "series", Points: d.Points}, nil
+	}
+	return DriverSpec{}, fmt.Errorf("driver %T cannot be encoded", d)
+}
+
+// Driver builds the driver a spec describes.
+func (sp DriverSpec) Driver() (Driver, error) {
+	d, err := sp.build()
+	if err != nil {
+		return nil, err
+	}
+	if err := validateDriver(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (sp DriverSpec) build() (Driver, error) {
+	switch sp.Kind {
+	case "constant":
+		return Constant{V: sp.Value}, nil
+	case "step":
+		return StepChange{Before: sp.Before, After: sp.After, At: sp.At}, nil
+	case "ramp":
+		return Ramp{From: sp.From, To: sp.To, Start: sp.Start, End: sp.End}, nil
+	case "sine":
+		return Sine{Offset: sp.Offset, Amplitude: sp.Amplitude, Period: sp.Period, Phase: sp.Phase}, nil
+	case "square":
+		return Square{Low: sp.Low, High: sp.High, Period: sp.Period, Duty: sp.Duty}, nil
+	case "piecewise":
+		return Piecewise{Points: sp.Points}, nil
+	case "series":
+		return Series{Points: sp.Points}, nil
+	}
+	return nil, fmt.Errorf("unknown driver kind %q", sp.Kind)
+}
@@ -0,0 +1,78 @@
+package tag
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestAttachValidatesDrivers(t *testing.T) {
+	pts := func(ts ...float64) []Point {
+		var ps []Point
+		for _, x := range ts {
+			ps = append(ps, Point{T: x, V: x})
+		}
+		return ps
+	}
+	for _, tc := range []struct {
+		name string
+		d    Driver
+		ok   bool
+	}{
+		{"square duty 0", Square{Low: 1, High: 2, Period: 4}, true},
+		{"square duty 1", Square{Low: 1, High: 2, Period: 4, Duty: 1}, true},
+		{"square duty above 1", Square{Low: 1, High: 2, Period: 4, Duty: 1.5}, false},
+		{"square negative duty", Square{Duty: -0.1}, false},
+		{"square NaN duty", Square{Duty: math.NaN()}, false},
+		{"piecewise sorted", Piecewise{Points: pts(0, 1, 5)}, true},
+		{"piecewise unsorted", Piecewise{Points: pts(0, 5, 1)}, false},
+		{"piecewise repeated time", Piecewise{Points: pts(0, 1, 1)}, false},
+		{"series sorted", Series{Points: pts(0, 2)}, true},
+		{"series unsorted", &Series{Points: pts(2, 0)}, false},
+		{"series empty", Series{}, true},
+	} {
+		sim := NewSimulation()
+		err := sim.Attach("B", FieldDemand, tc.d)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: Attach returned %v", tc.name, err)
+		}
+		if spec, encErr := EncodeDriver(tc.d); encErr == nil {
+			if _, err := spec.Driver(); (err == nil) != tc.ok {
+				t.Errorf("%s: DriverSpec.Driver returned %v", tc.name, err)
+			}
+		}
+	}
+}
+
+func TestSquareDutyDefaultsAgree(t *testing.T) {
+	var sp DriverSpec
+	if err := json.Unmarshal([]byte(`{"kind": "square", "low": 1, "high": 2, "period": 4}`), &sp); err != nil {
+		t.Fatal(err)
+	}
+	d, err := sp.Driver()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Square{Low: 1, High: 2, Period: 4}); d != want {
+		t.Fatalf("square without a duty decoded as %+v, want %+v", d, want)
+	}
+	for _, sq := range []Square{{Low: 1, High: 2, Period: 4}, {Low: 1, High: 2, Period: 4, Duty: 0.25}} {
+		spec, _ := EncodeDriver(sq)
+		raw, _ := json.Marshal(spec)
+		var back DriverSpec
+		json.Unmarshal(raw, &back)
+		if d, _ := back.Driver(); d != sq {
+			t.Errorf("%+v round-tripped through %s as %+v", sq, raw, d)
+		}
+	}
+}
+
+func TestReadSeriesCSVRejectsRepeatedTimes(t *testing.T) {
+	if _, err := ReadSeriesCSV(strings.NewReader("t,v\n2,1\n0,3\n")); err != nil {
+		t.Fatalf("unsorted rows: %v", err)
+	}
+	if _, err := ReadSeriesCSV(strings.NewReader("0,1\n1,2\n1,3\n")); err == nil {
+		t.Fatal("repeated time accepted")
+	}
+}
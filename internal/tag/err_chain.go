@@ -36,6 +36,16 @@ func chain(ids ...string) *ToteBubble {
 	return head
 }
 
+// findBubble walks the chain from root looking for id.
+func findBubble(root *ToteBubble, id string) *ToteBubble {
+	for t := root; t != nil; t = t.Child {
+		if t.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
 // Spawn full error chain for a failing link.
 func SpawnErrorChain(start *ToteBubble) *ErrorBubble {
 	root := &ErrorBubble{ID: start.ID + ".err", Origin: start}
@@ -75,7 +85,7 @@ func BackfeedAndReconcile(root *ErrorBubble, draw float64, receipts *[]Receipt,
 
 	*receipts = append(*receipts, Receipt{
 		Step: step, Type: RBackfeed, Subject: candidate.ID,
-		Note: "apply correction from chaostote", Value1: before, Value2: o.State,
+		Note: "apply correction from chaostote", Payload: change("state", before, o.State),
 	})
 
 	if math.Abs(o.State-o.Demand) <= o.Tolerance {
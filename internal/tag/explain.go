@@ -0,0 +1,305 @@
+package tag
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Outcomes of an explained run.
+const (
+	OutcomeCollapsed  = "collapsed"   // meta and chaostote reconciled
+	OutcomeConverging = "converging"  // meta still correcting at the end of the log
+	OutcomeStalled    = "stalled"     // meta born but corrections stopped
+	OutcomeBelowLimit = "below_limit" // error persisted without reaching the meta limit
+	OutcomeQuiet      = "quiet"       // no link ever failed
+)
+
+// maxErrorSamples bounds Report.Error; longer runs are bucketed by peak.
+const maxErrorSamples = 100
+
+// Report is the structured story of a receipt log.
+type Report struct {
+	FromStep  int           `json:"from_step"`
+	ToStep    int           `json:"to_step"`
+	Receipts  int           `json:"receipts"`
+	FirstFail *LinkFailure  `json:"first_failure,omitempty"`
+	Links     []LinkStory   `json:"links"`
+	Error     []ErrorSample `json:"error"`
+	Meta      *MetaStory    `json:"meta,omitempty"`
+	Outcome   string        `json:"outcome"`
+	EndStep   int           `json:"end_step"`
+	Narrative []string      `json:"narrative"`
+}
+
+// LinkFailure is the first injection of error by a link.
+type LinkFailure struct {
+	Subject string  `json:"subject"`
+	Step    int     `json:"step"`
+	Error   float64 `json:"error"`
+	Receipt uint64  `json:"receipt"`
+	Cause   string  `json:"cause,omitempty"` // note of the receipt that made it fail, if known
+}
+
+// LinkStory follows one error-chain link through the run.
+type LinkStory struct {
+	Subject        string  `json:"subject"`
+	FirstFailStep  int     `json:"first_fail_step,omitempty"`
+	PeakError      float64 `json:"peak_error"`
+	PeakStep       int     `json:"peak_step,omitempty"`
+	Corrections    int     `json:"corrections"`
+	Corrected      float64 `json:"corrected"` // total |state change| from backfeed
+	ReconciledStep int     `json:"reconciled_step,omitempty"`
+}
+
+// ErrorSample is the error injected into the chaostote at a step, summed over links.
+type ErrorSample struct {
+	Step     int     `json:"step"`
+	Injected float64 `json:"injected"`
+}
+
+// MetaStory describes the meta totebubble's life.
+type MetaStory struct {
+	Subject    string   `json:"subject"`
+	BornStep   int      `json:"born_step"`
+	Total      float64  `json:"total"` // chaostote error at birth
+	Limit      float64  `json:"limit"`
+	Triggers   []string `json:"triggers,omitempty"` // links whose error was live at birth
+	Drains     int      `json:"drains"`
+	Drained    float64  `json:"drained"`
+	LastDrain  int      `json:"last_drain_step,omitempty"`
+	Energy     float64  `json:"energy"` // after the last drain
+	Collapsed  bool     `json:"collapsed"`
+	CollapseAt int      `json:"collapse_step,omitempty"`
+}
+
+// Explain analyses a receipt log, oldest first.
+func Explain(rs []Receipt) Report {
+	rep := Report{Receipts: len(rs), Links: []LinkStory{}, Error: []ErrorSample{}, Narrative: []string{}}
+	if len(rs) == 0 {
+		rep.Outcome = OutcomeQuiet
+		rep.Narrative = append(rep.Narrative, "The log is empty.")
+		return rep
+	}
+	rep.FromStep, rep.ToStep = rs[0].Step, rs[len(rs)-1].Step
+	g := NewCausalGraph(rs)
+
+	links := map[string]*LinkStory{}
+	var order []string
+	link := func(subject string) *LinkStory {
+		l := links[subject]
+		if l == nil {
+			l = &LinkStory{Subject: subject}
+			links[subject] = l
+			order = append(order, subject)
+		}
+		return l
+	}
+	var series []ErrorSample
+	lastBackfeed := 0
+
+	for _, r := range rs {
+		switch r.Type {
+		case RInject:
+			v := payloadAfter(r)
+			if n := len(series); n == 0 || series[n-1].Step != r.Step {
+				series = append(series, ErrorSample{Step: r.Step})
+			}
+			series[len(series)-1].Injected += v
+			if v <= 0 {
+				continue
+			}
+			l := link(r.Subject)
+			if l.FirstFailStep == 0 {
+				l.FirstFailStep = r.Step
+			}
+			if v > l.PeakError {
+				l.PeakError, l.PeakStep = v, r.Step
+			}
+			if rep.FirstFail == nil {
+				rep.FirstFail = &LinkFailure{Subject: r.Subject, Step: r.Step, Error: v, Receipt: r.ID}
+				if len(r.Parents) > 0 { // an inject has at most one parent
+					if c, ok := g.Receipt(r.Parents[0]); ok {
+						rep.FirstFail.Cause = fmt.Sprintf("%s (%s, step %d)", c.Note, c.Subject, c.Step)
+					}
+				}
+			}
+		case RMetaBirth:
+			if rep.Meta != nil {
+				continue
+			}
+			m := &MetaStory{Subject: r.Subject, BornStep: r.Step}
+			if r.Payload != nil {
+				m.Total, m.Limit = r.Payload.After, r.Payload.Limit
+			}
+			m.Energy = m.Total
+			for _, p := range r.Parents {
+				if c, ok := g.Receipt(p); ok {
+					m.Triggers = append(m.Triggers, c.Subject)
+				}
+			}
+			rep.Meta = m
+		case RDrain:
+			if m := rep.Meta; m != nil && r.Payload != nil {
+				m.Drains++
+				m.Drained += r.Payload.Before - r.Payload.After
+				m.LastDrain, m.Energy = r.Step, r.Payload.After
+			}
+		case RBackfeed:
+			l := link(r.Subject)
+			l.Corrections++
+			if r.Payload != nil {
+				l.Corrected += math.Abs(r.Payload.After - r.Payload.Before)
+			}
+			lastBackfeed = r.Step
+		case RReconcile:
+			if rep.Meta != nil && r.Subject == rep.Meta.Subject {
+				rep.Meta.Collapsed, rep.Meta.CollapseAt = true, r.Step
+			} else if l := link(r.Subject); l.ReconciledStep == 0 {
+				l.ReconciledStep = r.Step
+			}
+		}
+	}
+
+	for _, s := range order {
+		rep.Links = append(rep.Links, *links[s])
+	}
+	rep.Error = downsample(series)
+	rep.Outcome, rep.EndStep = outcome(rep, series, lastBackfeed)
+	rep.Narrative = narrate(rep)
+	return rep
+}
+
+func payloadAfter(r Receipt) float64 {
+	if r.Payload == nil {
+		return 0
+	}
+	return r.Payload.After
+}
+
+// outcome classifies how the log ends. A meta that made no correction in the
+// last tenth of the log (at least 10 steps) counts as stalled.
+func outcome(rep Report, series []ErrorSample, lastBackfeed int) (string, int) {
+	m := rep.Meta
+	switch {
+	case m != nil && m.Collapsed:
+		return OutcomeCollapsed, m.CollapseAt
+	case m != nil:
+		quiet := max(10, (rep.ToStep-rep.FromStep)/10)
+		last := max(lastBackfeed, m.LastDrain)
+		if rep.ToStep-last > quiet {
+			return OutcomeStalled, last
+		}
+		return OutcomeConverging, rep.ToStep
+	case len(series) > 0 && series[len(series)-1].Injected > 0:
+		return OutcomeBelowLimit, rep.ToStep
+	}
+	return OutcomeQuiet, rep.ToStep
+}
+
+func downsample(series []ErrorSample) []ErrorSample {
+	if len(series) <= maxErrorSamples {
+		return append([]ErrorSample{}, series...)
+	}
+	out := make([]ErrorSample, 0, maxErrorSamples)
+	per := (len(series) + maxErrorSamples - 1) / maxErrorSamples
+	for i := 0; i < len(series); i += per {
+		b := series[i]
+		for _, s := range series[i:min(i+per, len(series))] {
+			if s.Injected > b.Injected {
+				b = s
+			}
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+func narrate(rep Report) []string {
+	var n []string
+	say := func(format string, args ...any) { n = append(n, fmt.Sprintf(format, args...)) }
+
+	say("The log covers steps %d–%d (%d receipts).", rep.FromStep, rep.ToStep, rep.Receipts)
+	if f := rep.FirstFail; f != nil {
+		line := fmt.Sprintf("%s failed first, at step %d, injecting %.4f into the chaostote", f.Subject, f.Step, f.Error)
+		if f.Cause != "" {
+			line += " after " + f.Cause
+		}
+		say("%s.", line)
+	} else {
+		say("No link ever left its tolerance.")
+	}
+
+	if len(rep.Error) > 0 {
+		peak := rep.Error[0]
+		for _, s := range rep.Error {
+			if s.Injected > peak.Injected {
+				peak = s
+			}
+		}
+		last := rep.Error[len(rep.Error)-1]
+		say("Injected error peaked at %.4f (step %d) and was %.4f at step %d.", peak.Injected, peak.Step, last.Injected, last.Step)
+	}
+	var failing []string
+	for _, l := range rep.Links {
+		if l.FirstFailStep > 0 {
+			failing = append(failing, fmt.Sprintf("%s (peak %.4f at step %d)", l.Subject, l.PeakError, l.PeakStep))
+		}
+	}
+	if len(failing) > 1 {
+		say("Links that contributed error: %s.", strings.Join(failing, ", "))
+	}
+
+	if m := rep.Meta; m != nil {
+		line := fmt.Sprintf("Meta %s was born at step %d when the chaostote held %.4f, over the limit of %.4f", m.Subject, m.BornStep, m.Total, m.Limit)
+		if len(m.Triggers) > 0 {
+			line += "; live error came from " + strings.Join(m.Triggers, ", ")
+		}
+		say("%s.", line)
+		if m.Drains > 0 {
+			say("It drained %.4f in %d draws, the last at step %d, leaving %.4f.", m.Drained, m.Drains, m.LastDrain, m.Energy)
+		}
+	}
+
+	culprits := append([]LinkStory(nil), rep.Links...)
+	sort.SliceStable(culprits, func(i, j int) bool { return culprits[i].Corrected > culprits[j].Corrected })
+	for _, l := range culprits {
+		if l.Corrections == 0 {
+			continue
+		}
+		line := fmt.Sprintf("Culprit %s received %d corrections totalling %.4f", l.Subject, l.Corrections, l.Corrected)
+		if l.ReconciledStep > 0 {
+			line += fmt.Sprintf(" and reconciled locally at step %d", l.ReconciledStep)
+		}
+		say("%s.", line)
+	}
+
+	switch rep.Outcome {
+	case OutcomeCollapsed:
+		say("The field collapsed at step %d: meta and chaostote reconciled.", rep.EndStep)
+	case OutcomeConverging:
+		say("At step %d meta was still correcting; the run had not yet reconciled.", rep.EndStep)
+	case OutcomeStalled:
+		say("Corrections stopped after step %d without the field collapsing: the run stalled.", rep.EndStep)
+	case OutcomeBelowLimit:
+		say("Error persisted to step %d but never exceeded the meta limit, so nothing corrected it.", rep.EndStep)
+	default:
+		say("Nothing needed reconciling.")
+	}
+	return n
+}
+
+// Explain analyses the simulation's retained receipts.
+func (s *Simulation) Explain(fromStep, toStep int) Report {
+	s.mu.Lock()
+	rs := s.Ledger.All()
+	s.mu.Unlock()
+	kept := rs[:0]
+	for _, r := range rs {
+		if r.Step >= fromStep && (toStep <= 0 || r.Step <= toStep) {
+			kept = append(kept, r)
+		}
+	}
+	return Explain(kept)
+}
@@ -0,0 +1,199 @@
+package tag
+
+import (
+	"math"
+	"strings"
+)
+
+// Layout tuning for the force-directed placement of frame bubbles.
+const (
+	layoutIterations = 300
+	layoutSpring     = 1.0  // ideal edge length before normalisation
+	layoutErrSpring  = 0.45 // tote ↔ own error bubble
+	layoutMargin     = 0.85 // normalised extent; leaves room for radii
+)
+
+// Frame builds a drawable frame of the current state: one tote and one error
+// bubble per node, plus the meta bubble once born. Positions come from a
+// deterministic force-directed layout that depends only on topology.
+func (s *Simulation) Frame() Frame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.frame()
+}
+
+func (s *Simulation) frame() Frame {
+	f := Frame{
+		Schema:     SchemaVersion,
+		Step:       s.StepNum,
+		Equilibria: map[string]bool{},
+		ErrScalars: map[string]float64{},
+		Bubbles:    []Bubble{},
+		Links:      [][2]string{},
+	}
+	pos := s.layout()
+
+	// scale radii against the largest magnitudes so any topology fits
+	scale, errScale := 0.0, s.ParamsCfg.Limit
+	for t := s.Root; t != nil; t = t.Child {
+		scale = math.Max(scale, math.Max(math.Abs(t.State), math.Abs(t.Demand)))
+		if e := s.errorOf(t); e != nil {
+			errScale = math.Max(errScale, e.ErrorValue)
+		}
+	}
+	if scale == 0 {
+		scale = 1
+	}
+	if errScale <= 0 {
+		errScale = 1
+	}
+
+	for t := s.Root; t != nil; t = t.Child {
+		excess := math.Max(0, math.Abs(t.State-t.Demand)-t.Tolerance)
+		f.Equilibria[t.ID] = excess == 0
+		tote := Bubble{
+			ID: t.ID, Label: t.ID + ".tote", Kind: "tote",
+			Center: pos[t.ID+".tote"], Radius: 0.04 + 0.08*math.Abs(t.State)/scale,
+			Excess: excess, Energy: t.State, ColorHint: "primary",
+		}
+		errB := Bubble{ID: t.ID, Label: t.ID + ".err", Kind: "error", Center: pos[t.ID+".err"], ColorHint: "error"}
+		if e := s.errorOf(t); e != nil {
+			f.ErrScalars[t.ID] = e.ErrorValue
+			errB.Excess, errB.Energy = e.ErrorValue, e.ErrorValue
+			errB.Radius = 0.01 + 0.06*e.ErrorValue/errScale
+			if e.IsCulprit && !e.Resolved {
+				errB.ColorHint = "culprit"
+			}
+		} else {
+			f.ErrScalars[t.ID] = 0
+			errB.Radius = 0.01
+		}
+		f.Bubbles = append(f.Bubbles, tote, errB)
+		if t.Child != nil {
+			f.Links = append(f.Links, [2]string{t.ID + ".tote", t.Child.ID + ".tote"})
+		}
+		f.Links = append(f.Links, [2]string{t.ID + ".tote", t.ID + ".err"})
+	}
+	if m := s.Meta; m != nil {
+		f.Bubbles = append(f.Bubbles, Bubble{
+			ID: m.ID, Label: m.ID, Kind: "meta", Center: pos[m.ID],
+			Radius: 0.03 + 0.08*math.Min(1, m.State/errScale), Energy: m.State, ColorHint: "meta",
+		})
+	}
+	return f
+}
+
+// layout returns bubble centres in [-1,1]², recomputing only when the
+// topology changes; callers hold s.mu.
+func (s *Simulation) layout() map[string][2]float64 {
+	var ids []string
+	for t := s.Root; t != nil; t = t.Child {
+		ids = append(ids, t.ID)
+	}
+	meta := ""
+	if s.Meta != nil {
+		meta = s.Meta.ID
+	}
+	key := strings.Join(ids, "\x00") + "\x01" + meta
+	if s.layoutCache != nil && s.layoutKey == key {
+		return s.layoutCache
+	}
+	s.layoutKey, s.layoutCache = key, forceLayout(ids, meta)
+	return s.layoutCache
+}
+
+type layoutEdge struct {
+	a, b int
+	len  float64
+}
+
+// forceLayout places a chain of totes, their error bubbles and an optional
+// meta bubble. Starting positions and iteration order are fixed, so the same
+// topology always yields the same picture.
+func forceLayout(ids []string, meta string) map[string][2]float64 {
+	n := len(ids)
+	var names []string
+	for _, id := range ids {
+		names = append(names, id+".tote")
+	}
+	for _, id := range ids {
+		names = append(names, id+".err")
+	}
+	var edges []layoutEdge
+	for i := 0; i < n; i++ {
+		if i+1 < n {
+			edges = append(edges, layoutEdge{i, i + 1, layoutSpring})
+			edges = append(edges, layoutEdge{n + i, n + i + 1, layoutSpring})
+		}
+		edges = append(edges, layoutEdge{i, n + i, layoutErrSpring})
+	}
+	if meta != "" {
+		names = append(names, meta)
+		for i := 0; i < n; i++ {
+			edges = append(edges, layoutEdge{2 * n, n + i, 1.5 * layoutSpring})
+		}
+	}
+
+	// seed: totes along an arc, errors just inside it, meta at the centre
+	p := make([][2]float64, len(names))
+	for i := 0; i < n; i++ {
+		a := math.Pi * (0.15 + 0.7*float64(i)/math.Max(1, float64(n-1)))
+		p[i] = [2]float64{-math.Cos(a) * float64(n), math.Sin(a) * float64(n) / 2}
+		p[n+i] = [2]float64{p[i][0] * 0.8, p[i][1]*0.8 - 0.3}
+	}
+
+	temp := 0.1 * float64(max(n, 1))
+	for it := 0; it < layoutIterations; it++ {
+		d := make([][2]float64, len(p))
+		for i := range p {
+			for j := i + 1; j < len(p); j++ {
+				dx, dy := p[i][0]-p[j][0], p[i][1]-p[j][1]
+				dist2 := dx*dx + dy*dy
+				if dist2 < 1e-6 {
+					dx, dy, dist2 = 1e-3*float64(j-i), 1e-3, 1e-6 // deterministic nudge apart
+				}
+				f := 0.5 / dist2 // repulsion ~ 1/r
+				d[i][0] += dx * f
+				d[i][1] += dy * f
+				d[j][0] -= dx * f
+				d[j][1] -= dy * f
+			}
+		}
+		for _, e := range edges {
+			dx, dy := p[e.b][0]-p[e.a][0], p[e.b][1]-p[e.a][1]
+			dist := math.Max(1e-3, math.Hypot(dx, dy))
+			f := (dist - e.len) / dist // spring toward its rest length
+			d[e.a][0] += dx * f
+			d[e.a][1] += dy * f
+			d[e.b][0] -= dx * f
+			d[e.b][1] -= dy * f
+		}
+		for i := range p {
+			l := math.Hypot(d[i][0], d[i][1])
+			if l > temp {
+				d[i][0], d[i][1] = d[i][0]/l*temp, d[i][1]/l*temp
+			}
+			p[i][0] += d[i][0]
+			p[i][1] += d[i][1]
+		}
+		temp *= 0.985
+	}
+
+	// centre and scale into the frame
+	var cx, cy, ext float64
+	for _, q := range p {
+		cx += q[0] / float64(len(p))
+		cy += q[1] / float64(len(p))
+	}
+	for _, q := range p {
+		ext = math.Max(ext, math.Max(math.Abs(q[0]-cx), math.Abs(q[1]-cy)))
+	}
+	if ext == 0 {
+		ext = 1
+	}
+	out := make(map[string][2]float64, len(p))
+	for i, q := range p {
+		out[names[i]] = [2]float64{(q[0] - cx) / ext * layoutMargin, (q[1] - cy) / ext * layoutMargin}
+	}
+	return out
+}
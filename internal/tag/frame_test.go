@@ -0,0 +1,83 @@
+package tag
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestForceLayout(t *testing.T) {
+	for _, tc := range []struct {
+		ids  []string
+		meta string
+	}{
+		{[]string{"A"}, ""},
+		{[]string{"A", "B"}, ""},
+		{[]string{"A", "B"}, "M"},
+		{[]string{"A", "B", "C", "D", "E", "F", "G", "H"}, "M"},
+	} {
+		name := fmt.Sprintf("%v+%q", tc.ids, tc.meta)
+		pos := forceLayout(tc.ids, tc.meta)
+		want := 2 * len(tc.ids)
+		if tc.meta != "" {
+			want++
+		}
+		if len(pos) != want {
+			t.Errorf("%s: placed %d bubbles, want %d", name, len(pos), want)
+		}
+		for label, c := range pos {
+			if math.Abs(c[0]) > 1 || math.Abs(c[1]) > 1 || math.IsNaN(c[0]) || math.IsNaN(c[1]) {
+				t.Errorf("%s: %s at %v, outside [-1,1]²", name, label, c)
+			}
+			for other, d := range pos {
+				if other != label && math.Hypot(c[0]-d[0], c[1]-d[1]) < 1e-3 {
+					t.Errorf("%s: %s and %s overlap", name, label, other)
+				}
+			}
+		}
+		if again := forceLayout(tc.ids, tc.meta); !reflect.DeepEqual(pos, again) {
+			t.Errorf("%s: layout is not deterministic", name)
+		}
+	}
+}
+
+func TestFrameFollowsTopology(t *testing.T) {
+	sim := NewSimulation()
+	sim.Step()
+	f := sim.Frame()
+	labels := map[string]bool{}
+	for _, b := range f.Bubbles {
+		if labels[b.Label] {
+			t.Errorf("label %s repeated", b.Label)
+		}
+		labels[b.Label] = true
+		if b.Radius <= 0 {
+			t.Errorf("%s has radius %g", b.Label, b.Radius)
+		}
+	}
+	for _, l := range f.Links {
+		if !labels[l[0]] || !labels[l[1]] {
+			t.Errorf("link %v names a missing bubble", l)
+		}
+	}
+	for id := range f.ErrScalars {
+		if !labels[id+".tote"] || !labels[id+".err"] {
+			t.Errorf("node %s lacks a tote or error bubble", id)
+		}
+	}
+
+	if err := sim.AddBubble(BubbleSpec{ID: "X", State: 1, Demand: 1, Tolerance: 0.1}); err != nil {
+		t.Fatal(err)
+	}
+	g := sim.Frame()
+	if len(g.Bubbles) != len(f.Bubbles)+2 {
+		t.Fatalf("%d bubbles after adding a node, had %d", len(g.Bubbles), len(f.Bubbles))
+	}
+	if _, ok := g.Equilibria["X"]; !ok {
+		t.Error("new node missing from equilibria")
+	}
+	if reflect.DeepEqual(f.Bubbles[0].Center, g.Bubbles[0].Center) {
+		t.Error("layout not recomputed for the new topology")
+	}
+}
@@ -0,0 +1,400 @@
+package tag
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrLimit is returned when a Host is at one of its resource limits.
+var ErrLimit = errors.New("limit reached")
+
+// maxScenarioSteps bounds the steps a scenario may pre-run on creation.
+const maxScenarioSteps = 100_000
+
+// Scenario is a recipe for a fresh simulation: the default chain, then
+// Params, Bubbles and journal Commands in that order, then Steps steps.
+type Scenario struct {
+	Params   *ParamsPatch `json:"params,omitempty"`
+	Bubbles  []BubbleSpec `json:"bubbles,omitempty"`
+	Commands []Command    `json:"commands,omitempty"`
+	Steps    int          `json:"steps,omitempty"`
+}
+
+// Build creates a simulation from the scenario.
+func (sc Scenario) Build() (*Simulation, error) {
+	if sc.Steps < 0 || sc.Steps > maxScenarioSteps {
+		return nil, fmt.Errorf("steps must be in [0, %d]", maxScenarioSteps)
+	}
+	s := NewSimulation()
+	if sc.Params != nil {
+		if err := s.SetParams(*sc.Params); err != nil {
+			return nil, err
+		}
+	}
+	for _, b := range sc.Bubbles {
+		if err := s.AddBubble(b); err != nil {
+			return nil, fmt.Errorf("bubble %q: %w", b.ID, err)
+		}
+	}
+	for i, c := range sc.Commands {
+		if err := s.Apply(c); err != nil {
+			return nil, fmt.Errorf("command %d (%s): %w", i, c.Op, err)
+		}
+	}
+	for i := 0; i < sc.Steps; i++ {
+		s.Step()
+	}
+	return s, nil
+}
+
+// HostLimits bounds what a Host keeps in memory and how hard it runs; zero
+// means unlimited.
+type HostLimits struct {
+	MaxSims    int           // simulations hosted at once
+	MaxRunning int           // simulations whose clock is running at once
+	IdleAfter  time.Duration // evict a simulation nobody has used for this long
+	Rates      ClockRates    // clock rates of hosted simulations; zero fields use the defaults
+}
+
+// SimInfo describes one hosted simulation.
+type SimInfo struct {
+	ID          string    `json:"id"`
+	Created     time.Time `json:"created"`
+	LastUsed    time.Time `json:"last_used"`
+	Step        int       `json:"step"`
+	Running     bool      `json:"running"`
+	Subscribers int       `json:"subscribers"`
+}
+
+type hosted struct {
+	id       string
+	created  time.Time
+	lastUsed time.Time
+	active   int // requests in flight, including open streams
+	sim      *Simulation
+	mux      *http.ServeMux
+}
+
+func (h *hosted) describe() SimInfo {
+	st := h.sim.Clock().Status()
+	return SimInfo{
+		ID: h.id, Created: h.created, LastUsed: h.lastUsed, Step: h.sim.Snapshot().Step,
+		Running: st.Running, Subscribers: st.Subscribers,
+	}
+}
+
+// Host keeps named simulations, each with its own clock, streams and full
+// /api/tag/* API, and evicts the ones left idle.
+type Host struct {
+	limits HostLimits
+
+	mu   sync.Mutex
+	next int
+	sims map[string]*hosted
+	stop chan struct{}
+	done chan struct{}
+}
+
+func NewHost(limits HostLimits) *Host {
+	h := &Host{limits: limits, sims: map[string]*hosted{}, stop: make(chan struct{}), done: make(chan struct{})}
+	go h.janitor()
+	return h
+}
+
+// Add hosts sim under id; an empty id picks the next free "sN".
+func (h *Host) Add(id string, sim *Simulation) (SimInfo, error) {
+	if id != "" {
+		if err := validID(id); err != nil {
+			return SimInfo{}, fmt.Errorf("invalid simulation id %q", id)
+		}
+	}
+	if err := sim.Clock().SetRates(h.limits.Rates); err != nil {
+		return SimInfo{}, err
+	}
+	h.mu.Lock()
+	if err := h.full(); err != nil {
+		h.mu.Unlock()
+		return SimInfo{}, err
+	}
+	for id == "" {
+		h.next++
+		if c := fmt.Sprintf("s%d", h.next); h.sims[c] == nil {
+			id = c
+		}
+	}
+	if h.sims[id] != nil {
+		h.mu.Unlock()
+		return SimInfo{}, fmt.Errorf("simulation %q already exists", id)
+	}
+	now := time.Now().UTC()
+	hs := &hosted{id: id, created: now, lastUsed: now, sim: sim, mux: http.NewServeMux()}
+	RegisterRoutes(hs.mux, sim)
+	h.sims[id] = hs
+	h.mu.Unlock()
+	return hs.describe(), nil
+}
+
+// full reports ErrLimit when MaxSims simulations are hosted; callers hold h.mu.
+func (h *Host) full() error {
+	if h.limits.MaxSims > 0 && len(h.sims) >= h.limits.MaxSims {
+		return fmt.Errorf("%d simulations hosted: %w", len(h.sims), ErrLimit)
+	}
+	return nil
+}
+
+// Get returns a hosted simulation.
+func (h *Host) Get(id string) (*Simulation, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hs := h.sims[id]
+	if hs == nil {
+		return nil, fmt.Errorf("simulation %q: %w", id, ErrNotFound)
+	}
+	return hs.sim, nil
+}
+
+// List describes every hosted simulation, oldest first.
+func (h *Host) List() []SimInfo {
+	h.mu.Lock()
+	all := make([]*hosted, 0, len(h.sims))
+	for _, hs := range h.sims {
+		all = append(all, hs)
+	}
+	h.mu.Unlock()
+	infos := make([]SimInfo, 0, len(all))
+	for _, hs := range all {
+		infos = append(infos, hs.describe())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if !infos[i].Created.Equal(infos[j].Created) {
+			return infos[i].Created.Before(infos[j].Created)
+		}
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+// Remove stops a simulation's clock, ends its streams and forgets it.
+func (h *Host) Remove(id string) error {
+	h.mu.Lock()
+	hs := h.sims[id]
+	delete(h.sims, id)
+	h.mu.Unlock()
+	if hs == nil {
+		return fmt.Errorf("simulation %q: %w", id, ErrNotFound)
+	}
+	hs.sim.Clock().Close()
+	return nil
+}
+
+// Close stops eviction and removes every simulation.
+func (h *Host) Close() {
+	select {
+	case <-h.stop:
+		return
+	default:
+	}
+	close(h.stop)
+	<-h.done
+	for _, si := range h.List() {
+		h.Remove(si.ID)
+	}
+}
+
+// acquire marks a simulation busy for one request. Streams start the clock,
+// so they are admitted only while fewer than MaxRunning clocks run.
+func (h *Host) acquire(id string, stream bool) (*hosted, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hs := h.sims[id]
+	if hs == nil {
+		return nil, fmt.Errorf("simulation %q: %w", id, ErrNotFound)
+	}
+	if stream {
+		c := hs.sim.Clock()
+		if !c.Status().Running {
+			if n := h.running(); h.limits.MaxRunning > 0 && n >= h.limits.MaxRunning {
+				return nil, fmt.Errorf("%d simulations running: %w", n, ErrLimit)
+			}
+			c.Start()
+		}
+	}
+	hs.active++
+	hs.lastUsed = time.Now().UTC()
+	return hs, nil
+}
+
+func (h *Host) release(hs *hosted) {
+	h.mu.Lock()
+	hs.active--
+	hs.lastUsed = time.Now().UTC()
+	h.mu.Unlock()
+}
+
+// running counts running clocks; callers hold h.mu.
+func (h *Host) running() int {
+	n := 0
+	for _, hs := range h.sims {
+		if hs.sim.Clock().Status().Running {
+			n++
+		}
+	}
+	return n
+}
+
+// janitor stops clocks nobody is watching and evicts idle simulations.
+func (h *Host) janitor() {
+	defer close(h.done)
+	every := 10 * time.Second
+	if h.limits.IdleAfter > 0 && h.limits.IdleAfter/4 < every {
+		every = max(h.limits.IdleAfter/4, 10*time.Millisecond)
+	}
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case now := <-t.C:
+			h.sweep(now)
+		}
+	}
+}
+
+func (h *Host) sweep(now time.Time) {
+	var idle, evict []*hosted
+	h.mu.Lock()
+	for id, hs := range h.sims {
+		switch {
+		case hs.active > 0:
+		case h.limits.IdleAfter > 0 && now.Sub(hs.lastUsed) > h.limits.IdleAfter:
+			delete(h.sims, id)
+			evict = append(evict, hs)
+		default:
+			idle = append(idle, hs)
+		}
+	}
+	h.mu.Unlock()
+	for _, hs := range evict {
+		hs.sim.Clock().Close()
+	}
+	for _, hs := range idle {
+		if c := hs.sim.Clock(); c.B.Subscribers() == 0 {
+			c.Stop()
+		}
+	}
+}
+
+// --- HTTP ---
+
+// CreateRequest creates a simulation from a scenario (default chain when
+// omitted) or from a checkpoint, plain or signed.
+type CreateRequest struct {
+	ID         string          `json:"id,omitempty"`
+	Scenario   *Scenario       `json:"scenario,omitempty"`
+	Checkpoint json.RawMessage `json:"checkpoint,omitempty"`
+}
+
+func (req CreateRequest) build() (*Simulation, error) {
+	switch {
+	case req.Scenario != nil && req.Checkpoint != nil:
+		return nil, fmt.Errorf("give either a scenario or a checkpoint, not both")
+	case req.Checkpoint != nil:
+		cp, err := ReadCheckpoint(bytes.NewReader(req.Checkpoint))
+		if err != nil {
+			return nil, err
+		}
+		return FromCheckpoint(cp)
+	case req.Scenario != nil:
+		return req.Scenario.Build()
+	}
+	return NewSimulation(), nil
+}
+
+// Register exposes /api/sims and, under /api/sims/{id}/, the /api/tag/* API
+// of each hosted simulation. audit, if not nil, records who created and
+// deleted simulations; each hosted simulation audits its own control routes.
+func (h *Host) Register(m *http.ServeMux, audit *Simulation) {
+	mux := NewRouter(m)
+	mux.audit = audit
+	h.register(mux)
+	mux.Finish()
+}
+
+func (h *Host) register(mux *Router) {
+	mux.HandleFunc("GET /api/sims", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(h.List())
+	})
+
+	mux.HandleFunc("POST /api/sims", func(w http.ResponseWriter, r *http.Request) {
+		var req CreateRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, BadJSON(err))
+				return
+			}
+		}
+		// a full host refuses before paying for the scenario; Add checks again
+		h.mu.Lock()
+		err := h.full()
+		h.mu.Unlock()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		sim, err := req.build()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		info, err := h.Add(req.ID, sim)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(info)
+	})
+
+	mux.HandleFunc("GET /api/sims/{id}", func(w http.ResponseWriter, r *http.Request) {
+		hs, err := h.acquire(r.PathValue("id"), false)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		defer h.release(hs)
+		json.NewEncoder(w).Encode(hs.describe())
+	})
+
+	mux.HandleFunc("DELETE /api/sims/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if err := h.Remove(r.PathValue("id")); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// the read role is checked before acquire can start a clock; the hosted
+	// router checks the rest
+	mux.HandleFuncRole("/api/sims/{id}/", RoleRead, func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		rest := strings.TrimPrefix(r.URL.Path, "/api/sims/"+id)
+		hs, err := h.acquire(id, rest == "/stream" || rest == "/ws")
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		defer h.release(hs)
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = "/api/tag" + rest
+		r2.URL.RawPath = ""
+		hs.mux.ServeHTTP(w, r2)
+	})
+}
@@ -0,0 +1,109 @@
+package tag
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHostLimits(t *testing.T) {
+	h := NewHost(HostLimits{MaxSims: 2, MaxRunning: 1})
+	defer h.Close()
+	for _, id := range []string{"a", "b"} {
+		if _, err := h.Add(id, NewSimulation()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := h.Add("c", NewSimulation()); !errors.Is(err, ErrLimit) {
+		t.Fatalf("third sim: %v, want ErrLimit", err)
+	}
+	if _, err := h.Add("a", NewSimulation()); err == nil {
+		t.Fatal("duplicate id accepted")
+	}
+
+	a, err := h.acquire("a", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.release(a)
+	if _, err := h.acquire("b", true); !errors.Is(err, ErrLimit) {
+		t.Fatalf("second running clock: %v, want ErrLimit", err)
+	}
+	b, err := h.acquire("b", false) // plain requests do not need a clock
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.release(b)
+}
+
+func TestHostEvictsIdleSims(t *testing.T) {
+	h := NewHost(HostLimits{IdleAfter: time.Hour})
+	defer h.Close()
+	h.Add("busy", NewSimulation())
+	h.Add("idle", NewSimulation())
+	busy, _ := h.acquire("busy", false)
+
+	h.sweep(time.Now().Add(2 * time.Hour))
+	if _, err := h.Get("idle"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("idle sim kept: %v", err)
+	}
+	if _, err := h.Get("busy"); err != nil {
+		t.Fatalf("sim with a request in flight evicted: %v", err)
+	}
+	h.release(busy)
+}
+
+func TestHostRefusesBeforeBuilding(t *testing.T) {
+	h := NewHost(HostLimits{MaxSims: 1})
+	defer h.Close()
+	mux := http.NewServeMux()
+	h.Register(mux, nil)
+	h.Add("only", NewSimulation())
+
+	body := `{"scenario": {"steps": 100000}}`
+	start := time.Now()
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("POST", "/api/sims", bytes.NewBufferString(body)))
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("full host: %d %s", w.Code, w.Body)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("full host took %s to refuse; it ran the scenario", d)
+	}
+}
+
+func TestHostedCheckpointCanRewind(t *testing.T) {
+	src := NewSimulation()
+	for i := 0; i < 10; i++ {
+		src.Step()
+	}
+	cp, err := src.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := json.Marshal(cp)
+	sim, err := CreateRequest{Checkpoint: raw}.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < DefaultRewindEvery+5; i++ {
+		sim.Step()
+	}
+	if err := sim.Rewind(12); err != nil {
+		t.Fatalf("rewind in a simulation built from a checkpoint: %v", err)
+	}
+	if got := sim.State().Step; got != 12 {
+		t.Fatalf("rewound to step %d", got)
+	}
+	f, err := sim.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr := f.RewindRange(); len(rr.Points) == 0 {
+		t.Fatal("fork of a restored simulation has no rewind points")
+	}
+}
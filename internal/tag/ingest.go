@@ -0,0 +1,168 @@
+package tag
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Observation is one measured sample for a ToteBubble.
+// Demand is typically an SLO target and State the measured value.
+type Observation struct {
+	Bubble string    `json:"bubble"`
+	TS     time.Time `json:"ts"`
+	State  *float64  `json:"state,omitempty"`
+	Demand *float64  `json:"demand,omitempty"`
+}
+
+// DefaultStaleAfter is how many steps an observed bubble may go without samples before it is reported stale.
+const DefaultStaleAfter = 10
+
+// ingestTrack remembers the last applied sample for one bubble.
+type ingestTrack struct {
+	lastTS   time.Time
+	lastStep int
+	stale    bool
+}
+
+// Ingest validates observations and queues them for the next Step.
+// Nothing is queued unless every observation is valid; on error the index of the offending one is returned.
+// Observations without a timestamp are stamped with the arrival time.
+func (s *Simulation) Ingest(obs ...Observation) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, o := range obs {
+		if err := s.validateObservation(o); err != nil {
+			return i, err
+		}
+	}
+	now := time.Now().Round(0) // wall clock only, so journaled samples compare the same on replay
+	stamped := make([]Observation, len(obs))
+	for i, o := range obs {
+		if o.TS.IsZero() {
+			o.TS = now
+		}
+		stamped[i] = o
+	}
+	if err := s.journalOp(OpIngest, stamped); err != nil {
+		return 0, err
+	}
+	s.pending = append(s.pending, stamped...)
+	return len(obs), nil
+}
+
+func (s *Simulation) validateObservation(o Observation) error {
+	if o.Bubble == "" {
+		return fmt.Errorf("observation missing bubble")
+	}
+	if findBubble(s.Root, o.Bubble) == nil {
+		return fmt.Errorf("unknown bubble %q", o.Bubble)
+	}
+	if o.State == nil && o.Demand == nil {
+		return fmt.Errorf("observation for %q carries neither state nor demand", o.Bubble)
+	}
+	return nil
+}
+
+// applyObservations drains the pending queue in timestamp order.
+// Late samples are dropped; observed fields take over from any bound driver.
+func (s *Simulation) applyObservations(step int, receipts *[]Receipt) {
+	sort.SliceStable(s.pending, func(i, j int) bool { return s.pending[i].TS.Before(s.pending[j].TS) })
+	for _, o := range s.pending {
+		tb := findBubble(s.Root, o.Bubble)
+		if tb == nil {
+			continue // removed since it was queued
+		}
+		tr := s.tracks[o.Bubble]
+		if tr == nil {
+			tr = &ingestTrack{}
+			s.tracks[o.Bubble] = tr
+		}
+		if !tr.lastTS.IsZero() && !o.TS.After(tr.lastTS) {
+			*receipts = append(*receipts, Receipt{
+				Step: step, Type: RLate, Subject: tb.ID,
+				Note: "late sample dropped (" + o.TS.Format(time.RFC3339Nano) + ")",
+			})
+			continue
+		}
+		tr.lastTS, tr.lastStep, tr.stale = o.TS, step, false
+		for _, fv := range []struct {
+			f Field
+			v *float64
+		}{{FieldState, o.State}, {FieldDemand, o.Demand}} {
+			if fv.v == nil {
+				continue
+			}
+			s.detach(tb.ID, fv.f)
+			ptr := fieldPtr(tb, fv.f)
+			before := *ptr
+			*ptr = *fv.v
+			*receipts = append(*receipts, Receipt{
+				Step: step, Type: RObserve, Subject: tb.ID,
+				Note: "observed " + string(fv.f), Payload: change(string(fv.f), before, *fv.v),
+			})
+		}
+	}
+	s.pending = s.pending[:0]
+
+	// missing samples: hold the last value, but say so once
+	ids := make([]string, 0, len(s.tracks))
+	for id := range s.tracks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		tr := s.tracks[id]
+		if !tr.stale && s.StaleAfter > 0 && step-tr.lastStep > s.StaleAfter {
+			tr.stale = true
+			*receipts = append(*receipts, Receipt{
+				Step: step, Type: RStale, Subject: id,
+				Note: fmt.Sprintf("no samples for %d steps; holding last value", step-tr.lastStep),
+			})
+		}
+	}
+}
+
+// DecodeObservations reads a JSON object, a JSON array, or line-delimited JSON objects.
+func DecodeObservations(r io.Reader) ([]Observation, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil, fmt.Errorf("empty body")
+	}
+	if body[0] == '[' {
+		var obs []Observation
+		if err := json.Unmarshal(body, &obs); err != nil {
+			return nil, err
+		}
+		return obs, nil
+	}
+	var one Observation
+	if err := json.Unmarshal(body, &one); err == nil {
+		return []Observation{one}, nil
+	}
+	var obs []Observation
+	sc := bufio.NewScanner(bytes.NewReader(body))
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	line := 0
+	for sc.Scan() {
+		line++
+		b := bytes.TrimSpace(sc.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		var o Observation
+		if err := json.Unmarshal(b, &o); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		obs = append(obs, o)
+	}
+	return obs, sc.Err()
+}
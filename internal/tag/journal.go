@@ -0,0 +1,387 @@
+package tag
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Command is one journaled state change. Replaying a journal's commands in
+// order against NewSimulation rebuilds the simulation exactly.
+type Command struct {
+	Seq  uint64          `json:"seq"`
+	Op   string          `json:"op"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+// Journal ops.
+const (
+	OpStep         = "step"
+	OpReset        = "reset"
+	OpRetention    = "retention"
+	OpIngest       = "ingest"
+	OpAttach       = "attach"
+	OpDetach       = "detach"
+	OpAddBubble    = "add_bubble"
+	OpRemoveBubble = "remove_bubble"
+	OpRelink       = "relink"
+	OpSetBubble    = "set_bubble"
+	OpRestore      = "restore"
+	OpHashChain    = "hash_chain"
+	OpSetParams    = "set_params"
+	OpAudit        = "audit"
+)
+
+type attachArgs struct {
+	Bubble string      `json:"bubble"`
+	Field  Field       `json:"field"`
+	Driver *DriverSpec `json:"driver,omitempty"`
+}
+
+type idArgs struct {
+	ID    string       `json:"id"`
+	After string       `json:"after,omitempty"`
+	Patch *BubblePatch `json:"patch,omitempty"`
+}
+
+// Journal is an append-only JSONL file of commands.
+type Journal struct {
+	mu     sync.Mutex
+	f      *os.File
+	enc    *json.Encoder
+	seq    uint64
+	err    error
+	path   string
+	torn   int64
+	onErr  func(error)
+	every  time.Duration // see SyncEvery
+	timer  *time.Timer   // pending sync of unsynced commands
+	closed bool
+}
+
+// DefaultJournalSync is how long a journaled command may wait for fsync.
+const DefaultJournalSync = time.Second
+
+// ErrJournal wraps a failed journal write. The command it was for is not
+// applied, and neither is any later one: the simulation stops changing
+// rather than drift from its journal.
+var ErrJournal = errors.New("journal write failed")
+
+// OpenJournal opens (or creates) a journal for appending and returns the
+// commands already in it, so the caller can replay them before resuming.
+// A torn final line is cut off the file; see Torn.
+func OpenJournal(path string) (*Journal, []Command, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+	j := &Journal{f: f, enc: json.NewEncoder(f), path: path, every: DefaultJournalSync}
+	cmds, good, err := readJournal(f)
+	if err == nil {
+		j.torn, err = truncate(f, good)
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("journal %s: %w", path, err)
+	}
+	if n := len(cmds); n > 0 {
+		j.seq = cmds[n-1].Seq
+	}
+	return j, cmds, nil
+}
+
+// truncate cuts f to size and reports how many bytes went.
+func truncate(f *os.File, size int64) (int64, error) {
+	fi, err := f.Stat()
+	if err != nil || fi.Size() == size {
+		return 0, err
+	}
+	return fi.Size() - size, f.Truncate(size)
+}
+
+// ReadJournal decodes every command in r. A final line without its newline
+// is a write cut short by a crash and is skipped; a complete line that does
+// not decode is an error.
+func ReadJournal(r io.Reader) ([]Command, error) {
+	cmds, _, err := readJournal(r)
+	return cmds, err
+}
+
+// readJournal also returns the length of the complete lines.
+func readJournal(r io.Reader) ([]Command, int64, error) {
+	var cmds []Command
+	var good int64
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		b, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return cmds, good, nil // anything in b is the torn line
+		}
+		if err != nil {
+			return cmds, good, err
+		}
+		good += int64(len(b))
+		if len(bytes.TrimSpace(b)) == 0 {
+			continue
+		}
+		var c Command
+		if err := json.Unmarshal(b, &c); err != nil {
+			return cmds, good, fmt.Errorf("line %d: %w", line, err)
+		}
+		cmds = append(cmds, c)
+	}
+}
+
+// Append writes one command. The first write error sticks and is returned by Err.
+func (j *Journal) Append(op string, args any) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.err != nil {
+		return j.err
+	}
+	c := Command{Seq: j.seq + 1, Op: op}
+	if args != nil {
+		b, err := json.Marshal(args)
+		if err != nil {
+			return j.fail(err)
+		}
+		c.Args = b
+	}
+	if err := j.enc.Encode(c); err != nil {
+		return j.fail(err)
+	}
+	j.seq = c.Seq
+	switch {
+	case j.every == 0:
+		if err := j.f.Sync(); err != nil {
+			return j.fail(err)
+		}
+	case j.every > 0 && j.timer == nil:
+		j.timer = time.AfterFunc(j.every, j.flush)
+	}
+	return nil
+}
+
+// SyncEvery sets when appended commands reach stable storage. With 0 every
+// Append fsyncs before it returns, so no acknowledged command is lost even
+// if the machine goes down; this costs a disk flush per step. With d > 0
+// (DefaultJournalSync unless changed) a command is synced at most d after
+// it was written, so a power cut loses at most the last d of commands. A
+// negative d leaves syncing to the OS and Close. A process crash alone
+// loses nothing under any policy: every command is written before Append
+// returns.
+func (j *Journal) SyncEvery(d time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.every = d
+}
+
+// flush runs on the sync timer.
+func (j *Journal) flush() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.timer = nil
+	if j.closed || j.err != nil {
+		return
+	}
+	if err := j.f.Sync(); err != nil {
+		j.fail(err)
+	}
+}
+
+// fail makes err stick; callers hold j.mu.
+func (j *Journal) fail(err error) error {
+	j.err = err
+	if j.onErr != nil {
+		j.onErr(err)
+	}
+	return err
+}
+
+// OnError calls fn with the first write or sync error. fn may run with the
+// simulation locked, so it must not call back into it.
+func (j *Journal) OnError(fn func(error)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.onErr = fn
+}
+
+func (j *Journal) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+func (j *Journal) Path() string { return j.path }
+
+// Torn is how many bytes of an unfinished last line OpenJournal cut off.
+func (j *Journal) Torn() int64 { return j.torn }
+
+// Sync flushes the journal to stable storage.
+func (j *Journal) Sync() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.f.Sync()
+}
+
+// Close syncs and closes the file.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.closed = true
+	if j.timer != nil {
+		j.timer.Stop()
+	}
+	if err := j.f.Sync(); err != nil {
+		j.f.Close()
+		return err
+	}
+	return j.f.Close()
+}
+
+// --- simulation side ---
+
+// SetJournal starts recording every state-changing command to j (nil stops).
+func (s *Simulation) SetJournal(j *Journal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.journal = j
+}
+
+// journalOp records a command before it is applied; callers hold s.mu and
+// have already validated it. On error the command must not be applied.
+// Commands also feed the rewind timeline.
+func (s *Simulation) journalOp(op string, args any) error {
+	if s.journal != nil {
+		if err := s.journal.Append(op, args); err != nil {
+			return fmt.Errorf("%w: %v", ErrJournal, err)
+		}
+	}
+	if s.tt != nil {
+		s.tt.record(op, args)
+	}
+	return nil
+}
+
+// JournalErr is the write error that stopped the simulation changing, if any.
+func (s *Simulation) JournalErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.journalErr()
+}
+
+// journalErr is JournalErr for callers holding s.mu.
+func (s *Simulation) journalErr() error {
+	if s.journal == nil {
+		return nil
+	}
+	return s.journal.Err()
+}
+
+// Apply executes one journaled command.
+func (s *Simulation) Apply(c Command) error {
+	switch c.Op {
+	case OpStep:
+		s.Step()
+		return nil
+	case OpReset:
+		s.Reset()
+		return nil
+	case OpSetParams:
+		var p ParamsPatch
+		if err := json.Unmarshal(c.Args, &p); err != nil {
+			return err
+		}
+		return s.SetParams(p)
+	case OpRetention:
+		var r Retention
+		if err := json.Unmarshal(c.Args, &r); err != nil {
+			return err
+		}
+		return s.SetRetention(r)
+	case OpHashChain:
+		var on bool
+		if err := json.Unmarshal(c.Args, &on); err != nil {
+			return err
+		}
+		s.SetHashChain(on)
+		return nil
+	case OpIngest:
+		var obs []Observation
+		if err := json.Unmarshal(c.Args, &obs); err != nil {
+			return err
+		}
+		_, err := s.Ingest(obs...)
+		return err
+	case OpAttach, OpDetach:
+		var a attachArgs
+		if err := json.Unmarshal(c.Args, &a); err != nil {
+			return err
+		}
+		if c.Op == OpDetach {
+			s.Detach(a.Bubble, a.Field)
+			return nil
+		}
+		if a.Driver == nil {
+			return fmt.Errorf("attach without driver")
+		}
+		d, err := a.Driver.Driver()
+		if err != nil {
+			return err
+		}
+		return s.Attach(a.Bubble, a.Field, d)
+	case OpAddBubble:
+		var spec BubbleSpec
+		if err := json.Unmarshal(c.Args, &spec); err != nil {
+			return err
+		}
+		return s.AddBubble(spec)
+	case OpAudit:
+		var a auditArgs
+		if err := json.Unmarshal(c.Args, &a); err != nil {
+			return err
+		}
+		s.Audit(a.Who, a.Action)
+		return nil
+	case OpRestore:
+		var cp Checkpoint
+		if err := json.Unmarshal(c.Args, &cp); err != nil {
+			return err
+		}
+		return s.Restore(&cp)
+	}
+
+	var a idArgs
+	if err := json.Unmarshal(c.Args, &a); err != nil {
+		return err
+	}
+	switch c.Op {
+	case OpRemoveBubble:
+		return s.RemoveBubble(a.ID)
+	case OpRelink:
+		return s.Relink(a.ID, a.After)
+	case OpSetBubble:
+		if a.Patch == nil {
+			return fmt.Errorf("set_bubble without patch")
+		}
+		return s.SetBubble(a.ID, *a.Patch)
+	}
+	return fmt.Errorf("unknown op %q", c.Op)
+}
+
+// Replay rebuilds a simulation from journaled commands.
+func Replay(cmds []Command) (*Simulation, error) {
+	s := NewSimulation()
+	for _, c := range cmds {
+		if err := s.Apply(c); err != nil {
+			return s, fmt.Errorf("replay command %d (%s): %w", c.Seq, c.Op, err)
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,141 @@
+package tag
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournalReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, cmds, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 0 {
+		t.Fatalf("new journal holds %d commands", len(cmds))
+	}
+	sim := NewSimulation()
+	sim.SetJournal(j)
+	viscosity := 0.1
+	for _, op := range []func() error{
+		func() error { return sim.Attach("B", FieldDemand, Ramp{From: 1.6, To: 2, Start: 0, End: 1}) },
+		func() error { sim.Step(); sim.Step(); return nil },
+		func() error { return sim.SetParams(ParamsPatch{Viscosity: &viscosity}) },
+		func() error { return sim.SetRetention(Retention{MaxReceipts: 500}) },
+		func() error { sim.SetHashChain(true); return nil },
+		func() error { sim.Step(); return nil },
+	} {
+		if err := op(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	j, cmds, err = OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	for i, c := range cmds {
+		if c.Seq != uint64(i+1) {
+			t.Fatalf("command %d has seq %d", i, c.Seq)
+		}
+	}
+	replayed, err := Replay(cmds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameState(t, sim, replayed)
+}
+
+func TestOpenJournalCutsTornLine(t *testing.T) {
+	for _, tc := range []struct {
+		name, body string
+		cmds       int
+		torn       int64
+		bad        bool
+	}{
+		{"clean", `{"seq":1,"op":"step"}` + "\n", 1, 0, false},
+		{"torn tail", `{"seq":1,"op":"step"}` + "\n" + `{"seq":2,"op":"st`, 1, 17, false},
+		{"blank lines", "\n" + `{"seq":1,"op":"step"}` + "\n\n", 1, 0, false},
+		{"corrupt line", `{"seq":1,"op":"step"}` + "\nnot json\n", 0, 0, true},
+	} {
+		path := filepath.Join(t.TempDir(), "journal.jsonl")
+		os.WriteFile(path, []byte(tc.body), 0o644)
+		j, cmds, err := OpenJournal(path)
+		if tc.bad {
+			if err == nil {
+				j.Close()
+				t.Errorf("%s: opened", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if len(cmds) != tc.cmds || j.Torn() != tc.torn {
+			t.Errorf("%s: %d commands, %d bytes torn; want %d and %d", tc.name, len(cmds), j.Torn(), tc.cmds, tc.torn)
+		}
+		if err := j.Append(OpStep, nil); err != nil {
+			t.Fatal(err)
+		}
+		j.Close()
+		b, _ := os.ReadFile(path)
+		if !strings.HasSuffix(string(b), `{"seq":2,"op":"step"}`+"\n") {
+			t.Errorf("%s: appended after the old commands as %q", tc.name, b)
+		}
+	}
+}
+
+func TestJournalSyncPolicy(t *testing.T) {
+	for _, every := range []time.Duration{0, 5 * time.Millisecond, -1} {
+		j, _, err := OpenJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		j.SyncEvery(every)
+		for i := 0; i < 3; i++ {
+			if err := j.Append(OpStep, nil); err != nil {
+				t.Fatalf("every %s: %v", every, err)
+			}
+		}
+		j.mu.Lock()
+		pending := j.timer != nil
+		j.mu.Unlock()
+		if pending != (every > 0) {
+			t.Errorf("every %s: sync pending = %v", every, pending)
+		}
+		time.Sleep(20 * time.Millisecond)
+		j.mu.Lock()
+		pending = j.timer != nil
+		j.mu.Unlock()
+		if pending {
+			t.Errorf("every %s: commands still waiting for sync", every)
+		}
+		if err := j.Close(); err != nil {
+			t.Fatalf("every %s: close: %v", every, err)
+		}
+	}
+}
+
+func TestJournalCloseStopsPendingSync(t *testing.T) {
+	j, _, err := OpenJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.SyncEvery(time.Millisecond)
+	j.Append(OpStep, nil)
+	if err := j.Close(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := j.Err(); err != nil {
+		t.Fatalf("sync after close: %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package tag
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Retention bounds what a Ledger keeps. Zero values disable each rule.
+type Retention struct {
+	MaxReceipts    int     `json:"max_receipts"`    // ring size
+	MaxAgeSteps    int     `json:"max_age_steps"`   // drop receipts older than this many steps
+	CompactEpsilon float64 `json:"compact_epsilon"` // skip diffuse receipts that moved less than this
+}
+
+// Validate rejects negative or non-finite limits.
+func (r Retention) Validate() error {
+	if r.MaxReceipts < 0 || r.MaxAgeSteps < 0 || !(r.CompactEpsilon >= 0) || math.IsInf(r.CompactEpsilon, 1) {
+		return fmt.Errorf("retention values must be finite and >= 0")
+	}
+	return nil
+}
+
+// DefaultRetention keeps the last 100k receipts and compacts near-identical diffusion.
+var DefaultRetention = Retention{MaxReceipts: 100000, CompactEpsilon: 1e-4}
+
+// Ledger is the bounded receipt log of a simulation. Every kept receipt has a
+// sequence number; Seq is one past the newest and Base is that of the oldest retained.
+type Ledger struct {
+	ret     Retention
+	entries []Receipt
+	base    uint64
+	seq     uint64
+	diffuse map[string]float64 // last kept diffuse value per subject
+	chained bool
+	head    string // Hash of the newest chained receipt
+}
+
+func NewLedger(r Retention) *Ledger {
+	return &Ledger{ret: r, diffuse: map[string]float64{}}
+}
+
+func (l *Ledger) Retention() Retention { return l.ret }
+func (l *Ledger) Base() uint64         { return l.base }
+func (l *Ledger) Seq() uint64          { return l.seq }
+func (l *Ledger) Len() int             { return len(l.entries) }
+
+// SetRetention changes the rules and applies the ring bound immediately.
+func (l *Ledger) SetRetention(r Retention) {
+	l.ret = r
+	l.trim()
+}
+
+// Chained reports whether appended receipts are hash-chained.
+func (l *Ledger) Chained() bool { return l.chained }
+
+// Head is the hash of the newest chained receipt.
+func (l *Ledger) Head() string { return l.head }
+
+// SetChained turns hash chaining on or off for receipts appended from now on.
+// The chain continues from the last head when re-enabled.
+func (l *Ledger) SetChained(on bool) { l.chained = on }
+
+// Append keeps r unless compaction suppresses it, and reports whether it was kept.
+// On a chained ledger the kept receipt's Prev and Hash are filled in.
+func (l *Ledger) Append(r *Receipt) bool {
+	if l.ret.CompactEpsilon > 0 && r.Type == RDiffuse {
+		if last, ok := l.diffuse[r.Subject]; ok && math.Abs(r.Payload.After-last) <= l.ret.CompactEpsilon {
+			return false
+		}
+		l.diffuse[r.Subject] = r.Payload.After
+	}
+	if l.chained {
+		r.Prev = l.head
+		r.Hash = HashReceipt(*r)
+		l.head = r.Hash
+	}
+	l.entries = append(l.entries, *r)
+	l.seq++
+	// trim in batches so appends stay amortised O(1)
+	if max := l.ret.MaxReceipts; max > 0 && len(l.entries) > max+max/4 {
+		l.trim()
+	}
+	return true
+}
+
+// Prune drops receipts older than MaxAgeSteps relative to step.
+func (l *Ledger) Prune(step int) {
+	if l.ret.MaxAgeSteps <= 0 {
+		return
+	}
+	cut := step - l.ret.MaxAgeSteps
+	n := 0
+	for n < len(l.entries) && l.entries[n].Step < cut {
+		n++
+	}
+	l.drop(n)
+}
+
+// trim enforces the ring bound.
+func (l *Ledger) trim() {
+	if max := l.ret.MaxReceipts; max > 0 && len(l.entries) > max {
+		l.drop(len(l.entries) - max)
+	}
+}
+
+func (l *Ledger) drop(n int) {
+	if n <= 0 {
+		return
+	}
+	l.entries = append([]Receipt(nil), l.entries[n:]...)
+	l.base += uint64(n)
+}
+
+// Clear empties the ledger; sequence numbers and the hash chain keep counting
+// so cursors stay unique and a reset stays visible in an exported chain.
+func (l *Ledger) Clear() {
+	l.entries = nil
+	l.base = l.seq
+	l.diffuse = map[string]float64{}
+}
+
+// All returns every retained receipt, oldest first.
+func (l *Ledger) All() []Receipt {
+	return append([]Receipt(nil), l.entries...)
+}
+
+// Since returns retained receipts from seq on; older cursors are clamped to Base.
+func (l *Ledger) Since(seq uint64) []Receipt {
+	if seq < l.base {
+		seq = l.base
+	}
+	if seq >= l.seq {
+		return nil
+	}
+	return l.entries[seq-l.base:]
+}
+
+// AfterStep returns the sequence number of the first retained receipt later than step.
+func (l *Ledger) AfterStep(step int) uint64 {
+	for i, r := range l.entries {
+		if r.Step > step {
+			return l.base + uint64(i)
+		}
+	}
+	return l.seq
+}
+
+// --- queries ---
+
+// DefaultPageSize and MaxPageSize bound Query results.
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// Query selects receipts; zero fields do not filter.
+type Query struct {
+	FromStep int
+	ToStep   int // inclusive; 0 means no upper bound
+	Filter   ReceiptFilter
+	Text     string // case-insensitive substring of Note
+	Cursor   uint64 // resume from a previous page's Next
+	Limit    int
+}
+
+// Page is one page of query results. Next is the cursor for the following page, 0 when done.
+type Page struct {
+	Receipts []Receipt `json:"receipts"`
+	Next     uint64    `json:"next,omitempty"`
+	Base     uint64    `json:"base"` // oldest cursor still retained
+}
+
+func (l *Ledger) Query(q Query) Page {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	text := strings.ToLower(q.Text)
+	page := Page{Receipts: []Receipt{}, Base: l.base}
+
+	from := q.Cursor
+	if from < l.base {
+		from = l.base
+	}
+	for seq := from; seq < l.seq; seq++ {
+		r := l.entries[seq-l.base]
+		if r.Step < q.FromStep || (q.ToStep > 0 && r.Step > q.ToStep) ||
+			!q.Filter.Match(r) || (text != "" && !strings.Contains(strings.ToLower(r.Note), text)) {
+			continue
+		}
+		if len(page.Receipts) == limit {
+			page.Next = seq
+			break
+		}
+		page.Receipts = append(page.Receipts, r)
+	}
+	return page
+}
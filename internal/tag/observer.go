@@ -0,0 +1,270 @@
+package tag
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ObserveOption configures how an observer receives events.
+type ObserveOption func(*observer)
+
+// Buffered delivers events on the observer's own goroutine through a queue
+// of n events, so the simulation never waits for the observer, which may
+// call back into it. Events that find the queue full are dropped; OnDrop
+// reports them.
+func Buffered(n int) ObserveOption {
+	return func(o *observer) { o.buffer = n }
+}
+
+// OnDrop tells a Buffered observer how many events its full queue dropped.
+// fn runs on the observer's goroutine, right after the last event delivered
+// before them.
+func OnDrop(fn func(n int)) ObserveOption {
+	return func(o *observer) { o.onDrop = fn }
+}
+
+// observer is one registered callback.
+type observer struct {
+	match   func(event) bool
+	fn      func(event)
+	buffer  int
+	onDrop  func(int)
+	box     *mailbox // Buffered observers only
+	stopped atomic.Bool
+}
+
+// event is either a committed receipt or the end of a step.
+type event struct {
+	receipt *Receipt
+	state   *SimState
+}
+
+// observers is the registry. mu guards only list, so cancel works inside a
+// callback. Each batch of events takes a ticket under s.mu and is delivered
+// once every earlier ticket has been, so events arrive in commit order
+// without s.mu being held while observers run.
+type observers struct {
+	mu   sync.Mutex
+	list []*observer // never changed in place, so a copy of the header is a snapshot
+
+	issued uint64 // tickets handed out; guarded by s.mu
+
+	turn    sync.Mutex
+	next    *sync.Cond // signalled when serving moves on
+	serving uint64     // ticket whose batch is being delivered
+}
+
+// wait blocks until it is ticket's turn to deliver.
+func (r *observers) wait(ticket uint64) {
+	r.turn.Lock()
+	defer r.turn.Unlock()
+	if r.next == nil {
+		r.next = sync.NewCond(&r.turn)
+	}
+	for r.serving != ticket {
+		r.next.Wait()
+	}
+}
+
+// done hands the turn to the next ticket.
+func (r *observers) done() {
+	r.turn.Lock()
+	defer r.turn.Unlock()
+	r.serving++
+	if r.next != nil {
+		r.next.Broadcast()
+	}
+}
+
+// mailbox is a Buffered observer's queue of at most size events. put never
+// blocks: an event that finds the queue full is counted against the newest
+// queued one instead.
+type mailbox struct {
+	mu     sync.Mutex
+	ready  *sync.Cond
+	size   int
+	queue  []queued
+	closed bool
+}
+
+type queued struct {
+	e       event
+	dropped int // events lost right after e
+}
+
+func newMailbox(n int) *mailbox {
+	b := &mailbox{size: n, queue: make([]queued, 0, n)}
+	b.ready = sync.NewCond(&b.mu)
+	return b
+}
+
+func (b *mailbox) put(e event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.closed:
+	case len(b.queue) >= b.size:
+		b.queue[len(b.queue)-1].dropped++
+	default:
+		b.queue = append(b.queue, queued{e: e})
+		b.ready.Signal()
+	}
+}
+
+// close lets run deliver what is already queued, then return.
+func (b *mailbox) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.ready.Signal()
+}
+
+func (b *mailbox) run(fn func(event), onDrop func(int)) {
+	b.mu.Lock()
+	for {
+		for len(b.queue) == 0 && !b.closed {
+			b.ready.Wait()
+		}
+		if len(b.queue) == 0 {
+			b.mu.Unlock()
+			return
+		}
+		q := b.queue[0]
+		copy(b.queue, b.queue[1:])
+		b.queue[len(b.queue)-1] = queued{}
+		b.queue = b.queue[:len(b.queue)-1]
+		b.mu.Unlock()
+		fn(q.e)
+		if q.dropped > 0 && onDrop != nil {
+			onDrop(q.dropped)
+		}
+		b.mu.Lock()
+	}
+}
+
+// --- registration ---
+
+// OnReceipt calls fn for every committed receipt.
+func (s *Simulation) OnReceipt(fn func(Receipt), opts ...ObserveOption) (cancel func()) {
+	return s.onType("", fn, opts)
+}
+
+// OnSpawn calls fn when an error mirror chain is spawned.
+func (s *Simulation) OnSpawn(fn func(Receipt), opts ...ObserveOption) (cancel func()) {
+	return s.onType(RSpawnChain, fn, opts)
+}
+
+// OnMetaBirth calls fn when the chaostote spawns a meta totebubble.
+func (s *Simulation) OnMetaBirth(fn func(Receipt), opts ...ObserveOption) (cancel func()) {
+	return s.onType(RMetaBirth, fn, opts)
+}
+
+// OnBackfeed calls fn whenever a correction is fed back to a culprit.
+func (s *Simulation) OnBackfeed(fn func(Receipt), opts ...ObserveOption) (cancel func()) {
+	return s.onType(RBackfeed, fn, opts)
+}
+
+// OnReconcile calls fn on local reconciliations and on field collapse.
+func (s *Simulation) OnReconcile(fn func(Receipt), opts ...ObserveOption) (cancel func()) {
+	return s.onType(RReconcile, fn, opts)
+}
+
+// OnQuench calls fn for quench receipts.
+func (s *Simulation) OnQuench(fn func(Receipt), opts ...ObserveOption) (cancel func()) {
+	return s.onType(RQuench, fn, opts)
+}
+
+// OnStep calls fn after every step with the state at its end.
+// The state's Receipts holds only the receipts committed by that step.
+func (s *Simulation) OnStep(fn func(SimState), opts ...ObserveOption) (cancel func()) {
+	return s.observe(
+		func(e event) bool { return e.state != nil },
+		func(e event) { fn(*e.state) },
+		opts,
+	)
+}
+
+func (s *Simulation) onType(t ReceiptType, fn func(Receipt), opts []ObserveOption) func() {
+	return s.observe(
+		func(e event) bool { return e.receipt != nil && (t == "" || e.receipt.Type == t) },
+		func(e event) { fn(*e.receipt) },
+		opts,
+	)
+}
+
+func (s *Simulation) observe(match func(event) bool, fn func(event), opts []ObserveOption) func() {
+	o := &observer{match: match, fn: fn}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.buffer > 0 {
+		o.box = newMailbox(o.buffer)
+		go o.box.run(o.fn, o.onDrop)
+	}
+
+	reg := &s.obs
+	reg.mu.Lock()
+	reg.list = append(reg.list[:len(reg.list):len(reg.list)], o)
+	reg.mu.Unlock()
+
+	return func() {
+		reg.mu.Lock()
+		for i, x := range reg.list {
+			if x == o {
+				reg.list = append(reg.list[:i:i], reg.list[i+1:]...)
+				break
+			}
+		}
+		reg.mu.Unlock()
+		if !o.stopped.Swap(true) && o.box != nil {
+			o.box.close()
+		}
+	}
+}
+
+// --- delivery ---
+
+// commit records receipts in the ledger and queues them for observers; callers hold s.mu.
+// Observers see every receipt, including those the ledger compacts away.
+func (s *Simulation) commit(rs ...Receipt) {
+	for i := range rs {
+		s.causes.link(&rs[i])
+		s.Ledger.Append(&rs[i])
+		s.unsent = append(s.unsent, event{receipt: &rs[i]})
+	}
+}
+
+// unlock releases s.mu and then delivers everything committed while it was held.
+// Synchronous observers run on the caller's goroutine; they may read the
+// simulation but must not call its mutating methods, which would wait for
+// their own delivery. Use Buffered for that. Any observer may cancel itself.
+func (s *Simulation) unlock() {
+	evs := s.unsent
+	s.unsent = nil
+	if len(evs) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	reg := &s.obs
+	ticket := reg.issued
+	reg.issued++
+	s.mu.Unlock()
+
+	reg.wait(ticket)
+	defer reg.done()
+	reg.mu.Lock()
+	list := reg.list
+	reg.mu.Unlock()
+	for _, e := range evs {
+		for _, o := range list {
+			if o.stopped.Load() || !o.match(e) {
+				continue
+			}
+			if o.box != nil {
+				o.box.put(e)
+			} else {
+				o.fn(e)
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package tag
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// stepAll runs n Steps on each of g goroutines and fails the test if they
+// have not finished within timeout.
+func stepAll(t *testing.T, sim *Simulation, g, n int, timeout time.Duration) {
+	t.Helper()
+	var wg sync.WaitGroup
+	for i := 0; i < g; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				sim.Step()
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatalf("%d goroutines × %d steps still running after %s", g, n, timeout)
+	}
+}
+
+func TestSyncObserverMayReadWhileOthersStep(t *testing.T) {
+	sim := NewSimulation()
+	var mu sync.Mutex
+	var steps []int
+	var ids []uint64
+	sim.OnStep(func(st SimState) {
+		_ = sim.State()
+		_ = sim.Bubbles()
+		mu.Lock()
+		steps = append(steps, st.Step)
+		mu.Unlock()
+	})
+	sim.OnReceipt(func(r Receipt) {
+		mu.Lock()
+		ids = append(ids, r.ID)
+		mu.Unlock()
+	})
+
+	stepAll(t, sim, 4, 250, 10*time.Second)
+
+	if len(steps) != 1000 {
+		t.Fatalf("observed %d steps, took 1000", len(steps))
+	}
+	for i, s := range steps {
+		if s != i+1 {
+			t.Fatalf("step %d delivered in position %d", s, i+1)
+		}
+	}
+	for i := 1; i < len(ids); i++ {
+		if ids[i] <= ids[i-1] {
+			t.Fatalf("receipt %d delivered after %d", ids[i], ids[i-1])
+		}
+	}
+}
+
+func TestObserverCancelsItself(t *testing.T) {
+	sim := NewSimulation()
+	calls := 0
+	var cancel func()
+	cancel = sim.OnStep(func(SimState) {
+		calls++
+		cancel()
+	})
+	sim.Step()
+	sim.Step()
+	if calls != 1 {
+		t.Fatalf("cancelled observer called %d times", calls)
+	}
+}
+
+func TestBufferedObserverDropsWhenFull(t *testing.T) {
+	sim := NewSimulation()
+	var total int
+	sim.OnReceipt(func(Receipt) { total++ })
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var got, dropped int
+	done := make(chan struct{})
+	cancel := sim.OnReceipt(func(Receipt) {
+		<-release
+		mu.Lock()
+		got++
+		mu.Unlock()
+	}, Buffered(4), OnDrop(func(n int) {
+		mu.Lock()
+		dropped += n
+		mu.Unlock()
+	}))
+
+	for i := 0; i < 20; i++ {
+		sim.Step() // must not wait for the stalled observer
+	}
+	close(release)
+	go func() {
+		cancel() // lets the observer drain its queue and stop
+		for {
+			mu.Lock()
+			n := got + dropped
+			mu.Unlock()
+			if n >= total {
+				close(done)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("delivered %d and dropped %d of %d receipts", got, dropped, total)
+	}
+	if got > 5 || dropped == 0 || got+dropped != total {
+		t.Fatalf("delivered %d and dropped %d of %d receipts with a queue of 4", got, dropped, total)
+	}
+}
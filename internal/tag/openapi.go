@@ -0,0 +1,362 @@
+package tag
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// APIVersion is the version of the /api/v1 surface described by OpenAPI.
+const APIVersion = "1.0.0"
+
+// Route documents one v1 endpoint. Path is relative to /api/v1 and uses
+// the same {wildcards} as the ServeMux patterns that serve it.
+type Route struct {
+	Method   string
+	Path     string
+	Summary  string
+	Query    []QueryParam
+	Request  any    // example value of the body type; nil for none
+	Response any    // example value of the success body type; nil for none
+	Status   int    // success status; 0 means 200
+	Media    string // success media type; "" means application/json
+}
+
+// QueryParam documents one query parameter; Type is a JSON Schema type.
+type QueryParam struct {
+	Name, Type, Doc string
+}
+
+var (
+	qFromStep = QueryParam{"from_step", "integer", "first step to include"}
+	qToStep   = QueryParam{"to_step", "integer", "last step to include; 0 means no bound"}
+	qTypes    = QueryParam{"types", "string", "comma-separated receipt types"}
+	qSubject  = QueryParam{"subject", "string", "comma-separated receipt subjects"}
+)
+
+// V1Routes is the route table of /api/v1. Every entry must be served by
+// RegisterRoutes or Host.Register and every route they serve must be here;
+// RegisterV1 refuses to start otherwise.
+var V1Routes = []Route{
+	{Method: "GET", Path: "/state", Summary: "Current state with retained receipts", Response: SimState{}},
+	{Method: "GET", Path: "/frame", Summary: "Drawable frame of the current state", Response: Frame{}},
+	{Method: "POST", Path: "/step", Summary: "Advance one step", Response: SimState{}},
+	{Method: "POST", Path: "/run", Summary: "Step until a condition holds", Request: RunRequest{}, Response: RunSummary{}},
+	{Method: "POST", Path: "/reset", Summary: "Rebuild the default scenario", Response: SimState{}},
+	{Method: "GET", Path: "/params", Summary: "Current parameters", Response: Params{}},
+	{Method: "POST", Path: "/params", Summary: "Change some parameters", Request: ParamsPatch{}, Response: Params{}},
+	{Method: "PATCH", Path: "/params", Summary: "Change some parameters", Request: ParamsPatch{}, Response: Params{}},
+	{Method: "POST", Path: "/ingest", Summary: "Queue telemetry observations (JSON, array or JSONL)", Request: []Observation{}, Response: IngestResult{}},
+	{Method: "GET", Path: "/receipts", Summary: "Query the receipt ledger", Response: Page{}, Query: []QueryParam{
+		qFromStep, qToStep, qTypes, qSubject,
+		{"q", "string", "text to find in notes"},
+		{"cursor", "integer", "continue after this cursor"},
+		{"limit", "integer", "page size"},
+	}},
+	{Method: "GET", Path: "/receipts/export", Summary: "Every retained receipt as JSONL", Response: Receipt{}, Media: "application/x-ndjson"},
+	{Method: "GET", Path: "/receipts/graph", Summary: "Causal graph of the retained receipts", Response: CausalGraph{}, Query: []QueryParam{
+		{"id", "integer", "narrow to the causes of this receipt"},
+		{"dir", "string", `"effects" to follow effects instead of causes`},
+		{"format", "string", `"dot" for Graphviz`},
+	}},
+	{Method: "GET", Path: "/explain", Summary: "Narrate the retained receipts", Response: Report{}, Query: []QueryParam{qFromStep, qToStep}},
+	{Method: "GET", Path: "/chain", Summary: "Receipt hash chain status", Response: ChainStatus{}},
+	{Method: "POST", Path: "/chain", Summary: "Turn the receipt hash chain on or off", Request: ChainStatus{}, Response: ChainStatus{}},
+	{Method: "GET", Path: "/retention", Summary: "Receipt retention policy", Response: Retention{}},
+	{Method: "POST", Path: "/retention", Summary: "Change the receipt retention policy", Request: Retention{}, Response: Retention{}},
+	{Method: "GET", Path: "/checkpoint", Summary: "Save the full state", Response: Checkpoint{}},
+	{Method: "POST", Path: "/checkpoint", Summary: "Restore a checkpoint, plain or signed", Request: Checkpoint{}, Response: SimState{}},
+	{Method: "GET", Path: "/bubbles", Summary: "List bubbles", Response: []BubbleInfo{}},
+	{Method: "POST", Path: "/bubbles", Summary: "Add a bubble", Request: BubbleSpec{}, Response: BubbleInfo{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/bubbles/{id}", Summary: "One bubble", Response: BubbleInfo{}},
+	{Method: "PATCH", Path: "/bubbles/{id}", Summary: "Change a bubble", Request: BubblePatch{}, Response: BubbleInfo{}},
+	{Method: "DELETE", Path: "/bubbles/{id}", Summary: "Remove a bubble", Status: http.StatusNoContent},
+	{Method: "POST", Path: "/bubbles/{id}/link", Summary: "Move a bubble after another", Request: struct {
+		After string `json:"after"`
+	}{}, Response: BubbleInfo{}},
+	{Method: "GET", Path: "/bubbles/{id}/history", Summary: "Recent samples of a bubble", Response: []BubbleSample{}},
+	{Method: "GET", Path: "/clock", Summary: "Clock status", Response: ClockStatus{}},
+	{Method: "POST", Path: "/clock", Summary: "Pause, resume or change speed", Request: ClockUpdate{}, Response: ClockStatus{}},
+	{Method: "GET", Path: "/stream", Summary: "Server-sent stream of frames", Response: StreamFrame{}, Media: "text/event-stream", Query: []QueryParam{
+		{"since_step", "integer", "resume after this step"}, qTypes, qSubject,
+		{"frame", "integer", "1 to attach a drawable Frame"},
+	}},
+	{Method: "POST", Path: "/rpc", Summary: `JSON-RPC 2.0 request or batch; the "methods" method lists the rest`, Request: RPCRequest{}, Response: RPCResponse{}},
+	{Method: "GET", Path: "/ws", Summary: "WebSocket carrying JSON-RPC 2.0 messages both ways, event notifications included", Status: http.StatusSwitchingProtocols},
+	{Method: "GET", Path: "/rewind", Summary: "Steps reachable by rewinding", Response: RewindRange{}},
+	{Method: "POST", Path: "/rewind", Summary: "Return to an earlier step", Request: struct {
+		Step int `json:"step"`
+	}{}, Response: SimState{}},
+	{Method: "GET", Path: "/forks", Summary: "List forks", Response: []ForkInfo{}},
+	{Method: "POST", Path: "/forks", Summary: "Fork now or at an earlier step; the fork serves this API under /forks/{id}/", Request: struct {
+		Step *int `json:"step,omitempty"`
+	}{}, Response: ForkInfo{}, Status: http.StatusCreated},
+	{Method: "DELETE", Path: "/forks/{id}", Summary: "Drop a fork", Status: http.StatusNoContent},
+	{Method: "GET", Path: "/forks/{id}/diff", Summary: "Compare a fork with its parent", Response: BranchDiff{}},
+	{Method: "GET", Path: "/sims", Summary: "List hosted simulations", Response: []SimInfo{}},
+	{Method: "POST", Path: "/sims", Summary: "Host a simulation from a scenario or checkpoint; it serves this API under /sims/{id}/", Request: CreateRequest{}, Response: SimInfo{}, Status: http.StatusCreated},
+	{Method: "GET", Path: "/sims/{id}", Summary: "One hosted simulation", Response: SimInfo{}},
+	{Method: "DELETE", Path: "/sims/{id}", Summary: "Stop and drop a hosted simulation", Status: http.StatusNoContent},
+}
+
+// v1Target maps a v1 path onto the unversioned route that serves it.
+func v1Target(path string) string {
+	rest := strings.TrimPrefix(path, "/api/v1")
+	if rest == "/sims" || strings.HasPrefix(rest, "/sims/") {
+		return "/api" + rest
+	}
+	return "/api/tag" + rest
+}
+
+// checkV1Routes compares V1Routes with what RegisterRoutes and Host.Register
+// serve; openapi_test.go keeps the two in step.
+func checkV1Routes() error {
+	rt := NewRouter(http.NewServeMux())
+	registerRoutes(rt, NewSimulation(), nil)
+	h := NewHost(HostLimits{})
+	h.register(rt)
+	h.Close()
+
+	served := map[string]bool{}
+	for _, p := range rt.Routes() {
+		served[p] = true
+	}
+	var problems []string
+	for _, r := range V1Routes {
+		p := r.Method + " " + v1Target("/api/v1"+r.Path)
+		if !served[p] {
+			problems = append(problems, "documented but not served: "+p)
+		}
+		delete(served, p)
+	}
+	for p := range served {
+		problems = append(problems, "served but not documented: "+p)
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("v1 route table out of date:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// RegisterV1 exposes /api/v1/openapi.json and serves /api/v1/* from the
+// /api/tag and /api/sims routes already registered on mux. v1 responses
+// carry an X-Tag-API-Version header.
+func RegisterV1(mux *http.ServeMux) {
+	doc, err := json.MarshalIndent(OpenAPI(), "", "  ")
+	if err != nil {
+		panic(err)
+	}
+
+	mux.HandleFunc("GET /api/v1/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Tag-API-Version", APIVersion)
+		w.Write(doc)
+	})
+
+	mux.HandleFunc("/api/v1/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Tag-API-Version", APIVersion)
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = v1Target(r.URL.Path)
+		r2.URL.RawPath = ""
+		if _, pattern := mux.Handler(r2); pattern == "" || pattern == "/" || pattern == "/api/v1/" {
+			writeError(w, fmt.Errorf("%s %s: %w", r.Method, r.URL.Path, ErrNotFound))
+			return
+		}
+		mux.ServeHTTP(w, r2)
+	})
+}
+
+// --- OpenAPI ---
+
+// OpenAPI builds the OpenAPI 3.1 description of /api/v1 from V1Routes and
+// the Go types they name.
+func OpenAPI() map[string]any {
+	g := &schemaGen{defs: map[string]any{}}
+	errRef := g.of(reflect.TypeOf(ErrorEnvelope{}))
+	paths := map[string]map[string]any{}
+	for _, r := range V1Routes {
+		op := map[string]any{
+			"summary":     r.Summary,
+			"operationId": operationID(r),
+		}
+		var params []any
+		for _, name := range wildcards(r.Path) {
+			params = append(params, map[string]any{
+				"name": name, "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+			})
+		}
+		for _, q := range r.Query {
+			params = append(params, map[string]any{
+				"name": q.Name, "in": "query", "description": q.Doc, "schema": map[string]any{"type": q.Type},
+			})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		if r.Request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": g.of(reflect.TypeOf(r.Request))}},
+			}
+		}
+		status := r.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		ok := map[string]any{"description": http.StatusText(status)}
+		if r.Response != nil {
+			media := r.Media
+			if media == "" {
+				media = "application/json"
+			}
+			ok["content"] = map[string]any{media: map[string]any{"schema": g.of(reflect.TypeOf(r.Response))}}
+		}
+		op["responses"] = map[string]any{
+			fmt.Sprint(status): ok,
+			"default": map[string]any{
+				"description": "Error",
+				"content":     map[string]any{"application/json": map[string]any{"schema": errRef}},
+			},
+		}
+		if paths[r.Path] == nil {
+			paths[r.Path] = map[string]any{}
+		}
+		paths[r.Path][strings.ToLower(r.Method)] = op
+	}
+	return map[string]any{
+		"openapi": "3.1.0",
+		"info": map[string]any{
+			"title":       "TAG simulation API",
+			"version":     APIVersion,
+			"description": fmt.Sprintf("SimState and Frame carry \"schema\": %d.", SchemaVersion),
+		},
+		"servers": []any{map[string]any{"url": "/api/v1"}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas":         g.defs,
+			"securitySchemes": map[string]any{"bearer": map[string]any{"type": "http", "scheme": "bearer"}},
+		},
+		// tokens are optional unless tagd runs with -auth
+		"security": []any{map[string]any{}, map[string]any{"bearer": []string{}}},
+	}
+}
+
+func operationID(r Route) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(r.Method))
+	for _, part := range strings.FieldsFunc(r.Path, func(c rune) bool { return c == '/' || c == '{' || c == '}' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+func wildcards(path string) []string {
+	var out []string
+	for _, part := range strings.Split(path, "/") {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			out = append(out, strings.TrimSuffix(part[1:], "}"))
+		}
+	}
+	return out
+}
+
+// schemaGen turns Go types into JSON Schema, following encoding/json's rules
+// for field names and omitempty. Named structs become shared components.
+type schemaGen struct {
+	defs map[string]any
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+func (g *schemaGen) of(t reflect.Type) map[string]any {
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case rawType:
+		return map[string]any{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.of(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": g.of(t.Elem())}
+	case reflect.Array:
+		return map[string]any{"type": "array", "items": g.of(t.Elem()), "minItems": t.Len(), "maxItems": t.Len()}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.defs[t.Name()]; !ok {
+			g.defs[t.Name()] = nil // reserve first, so recursive types terminate
+			g.defs[t.Name()] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]any{} // interfaces and anything else: any JSON value
+}
+
+func (g *schemaGen) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	g.fields(t, props, &required)
+	s := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
+
+func (g *schemaGen) fields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fields(ft, props, required)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.of(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package tag
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestV1RoutesMatchServedRoutes(t *testing.T) {
+	if err := checkV1Routes(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckV1RoutesReportsDrift(t *testing.T) {
+	saved := V1Routes
+	defer func() { V1Routes = saved }()
+
+	V1Routes = append(saved[1:len(saved):len(saved)], Route{Method: "GET", Path: "/nowhere", Summary: "Not served"})
+	err := checkV1Routes()
+	if err == nil {
+		t.Fatal("drift not reported")
+	}
+	gone := saved[0].Method + " " + v1Target("/api/v1"+saved[0].Path)
+	for _, want := range []string{"documented but not served: GET /api/tag/nowhere", "served but not documented: " + gone} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	b, err := json.Marshal(OpenAPI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range V1Routes {
+		if doc.Paths[r.Path][strings.ToLower(r.Method)] == nil {
+			t.Errorf("%s %s missing from the document", r.Method, r.Path)
+		}
+	}
+}
+
+func TestRegisterV1ServesUnversionedRoutes(t *testing.T) {
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, NewSimulation())
+	RegisterV1(mux)
+	r, _ := http.NewRequest("GET", "/api/v1/state", nil)
+	if _, pattern := mux.Handler(r); pattern != "/api/v1/" {
+		t.Fatalf("GET /api/v1/state matched %q", pattern)
+	}
+}
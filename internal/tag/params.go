@@ -0,0 +1,116 @@
+package tag
+
+import (
+	"fmt"
+	"math"
+)
+
+// ParamsPatch sets any subset of the simulation parameters. A nil field is
+// left as it is; a present value, zero included, is checked and applied.
+type ParamsPatch struct {
+	Viscosity *float64 `json:"viscosity,omitempty"`
+	Limit     *float64 `json:"limit,omitempty"`
+	Dt        *float64 `json:"dt,omitempty"`
+}
+
+// ParamError reports a parameter value outside its range.
+type ParamError struct {
+	Field  string  `json:"field"`
+	Value  float64 `json:"value"`
+	Reason string  `json:"reason"`
+}
+
+func (e *ParamError) Error() string { return e.Field + " " + e.Reason }
+
+// paramRange is the accepted interval of one parameter; Open excludes Min.
+type paramRange struct {
+	Min, Max float64
+	Open     bool
+}
+
+// paramRanges bound every parameter: viscosity in [0, 1], limit in (0, 1000]
+// and dt in (0, 10].
+var paramRanges = map[string]paramRange{
+	"viscosity": {Min: 0, Max: 1},
+	"limit":     {Min: 0, Max: 1000, Open: true},
+	"dt":        {Min: 0, Max: 10, Open: true},
+}
+
+func (r paramRange) check(field string, v float64) error {
+	lo := "["
+	if r.Open {
+		lo = "("
+	}
+	switch {
+	case math.IsNaN(v) || math.IsInf(v, 0):
+		return &ParamError{Field: field, Value: v, Reason: "must be finite"}
+	case v < r.Min || r.Open && v == r.Min || v > r.Max:
+		return &ParamError{Field: field, Value: v, Reason: fmt.Sprintf("must be in %s%g, %g]", lo, r.Min, r.Max)}
+	}
+	return nil
+}
+
+// fields pairs each present patch value with its name and destination.
+func (p ParamsPatch) fields(dst *Params) []struct {
+	name string
+	dst  *float64
+	v    *float64
+} {
+	return []struct {
+		name string
+		dst  *float64
+		v    *float64
+	}{{"viscosity", &dst.Viscosity, p.Viscosity}, {"limit", &dst.Limit, p.Limit}, {"dt", &dst.Dt, p.Dt}}
+}
+
+// Validate checks every present value against its range.
+func (p ParamsPatch) Validate() error {
+	var scratch Params
+	for _, c := range p.fields(&scratch) {
+		if c.v != nil {
+			if err := paramRanges[c.name].check(c.name, *c.v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks a whole parameter set, as restored from a checkpoint.
+func (p Params) Validate() error {
+	return ParamsPatch{Viscosity: &p.Viscosity, Limit: &p.Limit, Dt: &p.Dt}.Validate()
+}
+
+// SetParams validates the whole patch, then applies it. Each value that
+// actually changes commits a params receipt.
+func (s *Simulation) SetParams(p ParamsPatch) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.unlock()
+	if err := s.journalOp(OpSetParams, p); err != nil {
+		return err
+	}
+	for _, c := range p.fields(&s.ParamsCfg) {
+		if c.v == nil || *c.v == *c.dst {
+			continue
+		}
+		before := *c.dst
+		*c.dst = *c.v
+		s.collapsed = false
+		s.commit(Receipt{
+			Step: s.StepNum, Type: RParams, Subject: "params",
+			Note: "set " + c.name, Payload: change(c.name, before, *c.v),
+		})
+	}
+	s.Chi.Viscosity = s.ParamsCfg.Viscosity
+	return nil
+}
+
+// Params returns the current parameters.
+func (s *Simulation) Params() Params {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ParamsCfg
+}
@@ -0,0 +1,166 @@
+package tag
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PlaybackOptions controls how recorded samples are mapped onto steps.
+type PlaybackOptions struct {
+	Interval time.Duration // data time covered by one step (default 1s)
+	Speed    float64       // 1 = real time, 10 = ten times faster, 0 = as fast as possible
+	Tail     int           // extra steps to run after the data is exhausted
+}
+
+// PlaybackReport is a RunSummary annotated with data timestamps.
+type PlaybackReport struct {
+	RunSummary
+	Samples      int        `json:"samples"`
+	DataStart    time.Time  `json:"data_start"`
+	DataEnd      time.Time  `json:"data_end"`
+	MetaBornAt   *time.Time `json:"meta_born_at,omitempty"`
+	ReconciledAt *time.Time `json:"reconciled_at,omitempty"`
+}
+
+// Playback steps sim in lockstep with recorded observations:
+// step k ingests every sample in the k-th Interval window, then steps once.
+func Playback(sim *Simulation, obs []Observation, opt PlaybackOptions) (PlaybackReport, error) {
+	if opt.Interval <= 0 {
+		opt.Interval = time.Second
+	}
+	var rep PlaybackReport
+	if len(obs) == 0 {
+		return rep, fmt.Errorf("playback: no samples")
+	}
+	sort.SliceStable(obs, func(i, j int) bool { return obs[i].TS.Before(obs[j].TS) })
+	rep.Samples = len(obs)
+	rep.DataStart, rep.DataEnd = obs[0].TS, obs[len(obs)-1].TS
+
+	t := sim.beginTally()
+	var pace *time.Ticker
+	if opt.Speed > 0 {
+		pace = time.NewTicker(time.Duration(float64(opt.Interval) / opt.Speed))
+		defer pace.Stop()
+	}
+
+	// window start for each step, so receipts can be mapped back to data time
+	windows := map[int]time.Time{}
+	i := 0
+	for w := rep.DataStart; i < len(obs); w = w.Add(opt.Interval) {
+		end := w.Add(opt.Interval)
+		j := i
+		for j < len(obs) && obs[j].TS.Before(end) {
+			j++
+		}
+		if _, err := sim.Ingest(obs[i:j]...); err != nil {
+			return rep, fmt.Errorf("playback at %s: %w", w.Format(time.RFC3339), err)
+		}
+		i = j
+		if err := t.step(sim); err != nil {
+			return rep, fmt.Errorf("playback at %s: %w", w.Format(time.RFC3339), err)
+		}
+		windows[t.sum.ToStep] = w
+		if pace != nil {
+			<-pace.C
+		}
+	}
+	for k := 0; k < opt.Tail; k++ {
+		if err := t.step(sim); err != nil {
+			return rep, err
+		}
+	}
+
+	rep.RunSummary = t.sum
+	if w, ok := windows[rep.MetaBornStep]; ok {
+		rep.MetaBornAt = &w
+	}
+	if w, ok := windows[rep.ReconciledStep]; ok {
+		rep.ReconciledAt = &w
+	}
+	return rep, nil
+}
+
+// LoadObservations reads recorded samples from a .csv or .jsonl/.json file.
+func LoadObservations(path string) ([]Observation, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return ReadObservationsCSV(f)
+	}
+	return DecodeObservations(f)
+}
+
+// ReadObservationsCSV parses rows with a header naming ts (or time), bubble, state and demand.
+// Timestamps may be RFC 3339 or Unix seconds; empty state/demand cells are left unset.
+func ReadObservationsCSV(r io.Reader) ([]Observation, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	if _, ok := col["ts"]; !ok {
+		if i, ok := col["time"]; ok {
+			col["ts"] = i
+		}
+	}
+	for _, need := range []string{"ts", "bubble"} {
+		if _, ok := col[need]; !ok {
+			return nil, fmt.Errorf("csv header missing %q column", need)
+		}
+	}
+
+	var obs []Observation
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return obs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		ts, err := parseTimestamp(row[col["ts"]])
+		if err != nil {
+			return nil, fmt.Errorf("csv line %d: %w", line, err)
+		}
+		o := Observation{Bubble: strings.TrimSpace(row[col["bubble"]]), TS: ts}
+		for name, dst := range map[string]**float64{"state": &o.State, "demand": &o.Demand} {
+			i, ok := col[name]
+			if !ok || strings.TrimSpace(row[i]) == "" {
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimSpace(row[i]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("csv line %d: %s: %w", line, name, err)
+			}
+			*dst = &v
+		}
+		obs = append(obs, o)
+	}
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad timestamp %q", s)
+	}
+	return time.Unix(0, int64(secs*float64(time.Second))).UTC(), nil
+}
@@ -10,13 +10,42 @@ const (
 	RBackfeed   ReceiptType = "backfeed"
 	RReconcile  ReceiptType = "reconcile"
 	RQuench     ReceiptType = "quench"
+	RDrive      ReceiptType = "drive"
+	RObserve    ReceiptType = "observe"
+	RLate       ReceiptType = "late_sample"
+	RStale      ReceiptType = "stale_input"
+	RTopology   ReceiptType = "topology"
+	RSet        ReceiptType = "set"
+	RDrain      ReceiptType = "drain"
+	RParams     ReceiptType = "params"
+	RAudit      ReceiptType = "audit"
 )
 
+// Receipt records one thing the simulation did. ID is unique within a
+// simulation; Parents are the IDs of the receipts that caused it.
 type Receipt struct {
+	ID      uint64      `json:"id"`
+	Parents []uint64    `json:"parents,omitempty"`
 	Step    int         `json:"step"`
 	Type    ReceiptType `json:"type"`
 	Subject string      `json:"subject"`
 	Note    string      `json:"note"`
-	Value1  float64     `json:"value1,omitempty"`
-	Value2  float64     `json:"value2,omitempty"`
+	Payload *Payload    `json:"payload,omitempty"`
+
+	// Set by a hash-chained ledger: Prev is the predecessor's Hash.
+	Prev string `json:"prev,omitempty"`
+	Hash string `json:"hash,omitempty"`
+}
+
+// Payload is the quantity a receipt changed. Limit is set when the change
+// was measured against a threshold.
+type Payload struct {
+	Quantity string  `json:"quantity"`
+	Before   float64 `json:"before"`
+	After    float64 `json:"after"`
+	Limit    float64 `json:"limit,omitempty"`
+}
+
+func change(q string, before, after float64) *Payload {
+	return &Payload{Quantity: q, Before: before, After: after}
 }
@@ -0,0 +1,552 @@
+package tag
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// JSON-RPC 2.0 error codes. Errors from the simulation itself use
+// RPCServerError, or RPCInvalidParams for bad arguments, with the APIError
+// the REST API would have answered as Data.
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+	RPCServerError    = -32000
+)
+
+// maxRPCBody bounds one HTTP request, stdio line or WebSocket message.
+const maxRPCBody = 16 << 20
+
+// RPCRequest is a call, or a notification when ID is absent.
+type RPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// RPCResponse answers a call. Server notifications reuse it with Method and
+// Params set and no ID.
+type RPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  any             `json:"params,omitempty"`
+}
+
+type RPCError struct {
+	Code    int       `json:"code"`
+	Message string    `json:"message"`
+	Data    *APIError `json:"data,omitempty"`
+}
+
+// RPCEvent is the params of an "event" notification.
+type RPCEvent struct {
+	Subscription string      `json:"subscription"`
+	Frame        StreamFrame `json:"frame"`
+}
+
+// RPC serves a simulation's operations over JSON-RPC 2.0: one request or
+// batch per HTTP POST, one message per line over a stream such as stdio, or
+// one per WebSocket message. Only stdio and WebSocket clients can subscribe,
+// since events arrive as notifications.
+type RPC struct {
+	sim     *Simulation
+	methods map[string]rpcMethod
+}
+
+type rpcMethod func(c *rpcConn, params json.RawMessage) (any, error)
+
+// rpcConn is one client. send is nil for HTTP, which cannot be pushed to.
+type rpcConn struct {
+	ctx  context.Context
+	send func(RPCResponse) error
+
+	mu   sync.Mutex
+	subs map[string]func()
+	next int
+}
+
+func NewRPC(sim *Simulation) *RPC {
+	s := &RPC{sim: sim}
+	s.methods = map[string]rpcMethod{
+		"methods": func(*rpcConn, json.RawMessage) (any, error) {
+			names := make([]string, 0, len(s.methods))
+			for name := range s.methods {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return names, nil
+		},
+		"state": func(*rpcConn, json.RawMessage) (any, error) { return sim.Snapshot(), nil },
+		"frame": func(*rpcConn, json.RawMessage) (any, error) { return sim.Frame(), nil },
+		"step": func(_ *rpcConn, raw json.RawMessage) (any, error) {
+			p := struct {
+				N int `json:"n"`
+			}{N: 1}
+			if err := rpcParams(raw, &p); err != nil {
+				return nil, err
+			}
+			if p.N < 1 || p.N > maxScenarioSteps {
+				return nil, &ParamError{Field: "n", Value: float64(p.N), Reason: fmt.Sprintf("must be in [1, %d]", maxScenarioSteps)}
+			}
+			for i := 0; i < p.N; i++ {
+				sim.Step()
+			}
+			return sim.Snapshot(), nil
+		},
+		"run": func(_ *rpcConn, raw json.RawMessage) (any, error) {
+			var req RunRequest
+			if err := rpcParams(raw, &req); err != nil {
+				return nil, err
+			}
+			limit, conds, err := req.Conditions()
+			if err != nil {
+				return nil, err
+			}
+			return sim.RunUntil(limit, conds...)
+		},
+		"reset": func(*rpcConn, json.RawMessage) (any, error) {
+			sim.Reset()
+			return sim.Snapshot(), nil
+		},
+		"params.get": func(*rpcConn, json.RawMessage) (any, error) { return sim.Params(), nil },
+		"params.set": func(_ *rpcConn, raw json.RawMessage) (any, error) {
+			var p ParamsPatch
+			if err := rpcParams(raw, &p); err != nil {
+				return nil, err
+			}
+			if err := sim.SetParams(p); err != nil {
+				return nil, err
+			}
+			return sim.Params(), nil
+		},
+		"ingest": func(_ *rpcConn, raw json.RawMessage) (any, error) {
+			var p struct {
+				Observations []Observation `json:"observations"`
+			}
+			if err := rpcParams(raw, &p); err != nil {
+				return nil, err
+			}
+			n, err := sim.Ingest(p.Observations...)
+			if err != nil {
+				return nil, fmt.Errorf("observation %d: %w", n, err)
+			}
+			return IngestResult{Accepted: n}, nil
+		},
+		"receipts": func(_ *rpcConn, raw json.RawMessage) (any, error) {
+			var p rpcReceiptQuery
+			if err := rpcParams(raw, &p); err != nil {
+				return nil, err
+			}
+			q, err := p.query()
+			if err != nil {
+				return nil, err
+			}
+			return sim.Receipts(q), nil
+		},
+		"checkpoint": func(*rpcConn, json.RawMessage) (any, error) {
+			cp, err := sim.Checkpoint()
+			if err != nil {
+				return nil, &APIError{Status: http.StatusConflict, Code: CodeConflict, Message: err.Error()}
+			}
+			return cp, nil
+		},
+		"restore": func(_ *rpcConn, raw json.RawMessage) (any, error) {
+			cp, err := ReadCheckpoint(bytes.NewReader(raw))
+			if err != nil {
+				return nil, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidJSON, Message: "invalid checkpoint: " + err.Error()}
+			}
+			if err := sim.Restore(cp); err != nil {
+				return nil, err
+			}
+			return sim.Snapshot(), nil
+		},
+
+		// --- topology ---
+
+		"bubbles.list": func(*rpcConn, json.RawMessage) (any, error) { return sim.Bubbles(), nil },
+		"bubbles.get": func(_ *rpcConn, raw json.RawMessage) (any, error) {
+			var p rpcBubbleID
+			if err := rpcParams(raw, &p); err != nil {
+				return nil, err
+			}
+			return sim.Bubble(p.ID)
+		},
+		"bubbles.add": func(_ *rpcConn, raw json.RawMessage) (any, error) {
+			var spec BubbleSpec
+			if err := rpcParams(raw, &spec); err != nil {
+				return nil, err
+			}
+			if err := sim.AddBubble(spec); err != nil {
+				return nil, err
+			}
+			return sim.Bubble(spec.ID)
+		},
+		"bubbles.update": func(_ *rpcConn, raw json.RawMessage) (any, error) {
+			var p struct {
+				rpcBubbleID
+				BubblePatch
+			}
+			if err := rpcParams(raw, &p); err != nil {
+				return nil, err
+			}
+			if err := sim.SetBubble(p.ID, p.BubblePatch); err != nil {
+				return nil, err
+			}
+			return sim.Bubble(p.ID)
+		},
+		"bubbles.remove": func(_ *rpcConn, raw json.RawMessage) (any, error) {
+			var p rpcBubbleID
+			if err := rpcParams(raw, &p); err != nil {
+				return nil, err
+			}
+			return nil, sim.RemoveBubble(p.ID)
+		},
+		"bubbles.link": func(_ *rpcConn, raw json.RawMessage) (any, error) {
+			var p struct {
+				rpcBubbleID
+				After string `json:"after"`
+			}
+			if err := rpcParams(raw, &p); err != nil {
+				return nil, err
+			}
+			if err := sim.Relink(p.ID, p.After); err != nil {
+				return nil, err
+			}
+			return sim.Bubble(p.ID)
+		},
+
+		// --- clock and events ---
+
+		"clock.get": func(*rpcConn, json.RawMessage) (any, error) { return sim.Clock().Status(), nil },
+		"clock.set": func(_ *rpcConn, raw json.RawMessage) (any, error) {
+			var u ClockUpdate
+			if err := rpcParams(raw, &u); err != nil {
+				return nil, err
+			}
+			if err := sim.Clock().Update(u); err != nil {
+				return nil, err
+			}
+			return sim.Clock().Status(), nil
+		},
+		"subscribe":   s.subscribe,
+		"unsubscribe": unsubscribe,
+	}
+	return s
+}
+
+// rpcReadOnly are the methods the read role may call; the rest need control.
+var rpcReadOnly = map[string]bool{
+	"methods": true, "state": true, "frame": true, "params.get": true, "receipts": true,
+	"checkpoint": true, "bubbles.list": true, "bubbles.get": true, "clock.get": true,
+	"subscribe": true, "unsubscribe": true,
+}
+
+type rpcBubbleID struct {
+	ID string `json:"id"`
+}
+
+// rpcReceiptQuery is Query with the /api/tag/receipts parameter names.
+type rpcReceiptQuery struct {
+	FromStep int           `json:"from_step"`
+	ToStep   int           `json:"to_step"`
+	Types    []ReceiptType `json:"types"`
+	Subjects []string      `json:"subject"`
+	Text     string        `json:"q"`
+	Cursor   uint64        `json:"cursor"`
+	Limit    int           `json:"limit"`
+}
+
+func (p rpcReceiptQuery) query() (Query, error) {
+	for name, n := range map[string]int{"from_step": p.FromStep, "to_step": p.ToStep, "limit": p.Limit} {
+		if n < 0 {
+			return Query{}, &ParamError{Field: name, Value: float64(n), Reason: "must be >= 0"}
+		}
+	}
+	q := Query{FromStep: p.FromStep, ToStep: p.ToStep, Text: p.Text, Cursor: p.Cursor, Limit: p.Limit}
+	q.Filter = rpcFilter(p.Types, p.Subjects)
+	return q, nil
+}
+
+func rpcFilter(types []ReceiptType, subjects []string) ReceiptFilter {
+	var f ReceiptFilter
+	for _, t := range types {
+		if f.Types == nil {
+			f.Types = map[ReceiptType]bool{}
+		}
+		f.Types[t] = true
+	}
+	for _, sub := range subjects {
+		if f.Subjects == nil {
+			f.Subjects = map[string]bool{}
+		}
+		f.Subjects[sub] = true
+	}
+	return f
+}
+
+// rpcParams decodes by-name params strictly; absent params leave v as is.
+func rpcParams(raw json.RawMessage, v any) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return BadJSON(err)
+	}
+	return nil
+}
+
+// subscribe starts "event" notifications of stream frames, filtered like
+// /api/tag/stream. The result is the subscription ID.
+func (s *RPC) subscribe(c *rpcConn, raw json.RawMessage) (any, error) {
+	if c.send == nil {
+		return nil, &APIError{Status: http.StatusBadRequest, Code: CodeBadRequest, Message: "subscribe needs a stream transport, not HTTP"}
+	}
+	var p struct {
+		Types    []ReceiptType `json:"types"`
+		Subjects []string      `json:"subject"`
+		Frame    bool          `json:"frame"`
+	}
+	if err := rpcParams(raw, &p); err != nil {
+		return nil, err
+	}
+	cur := NewStreamCursor(s.sim.Cursor())
+	cur.WithFrame = p.Frame
+	filter := rpcFilter(p.Types, p.Subjects)
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.mu.Lock()
+	c.next++
+	id := strconv.Itoa(c.next)
+	c.subs[id] = cancel
+	c.mu.Unlock()
+
+	ticks, stop := s.sim.Clock().Subscribe(0)
+	go func() {
+		defer stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-ticks:
+				if !ok {
+					return
+				}
+				// a slow client skips the ticks it missed; the next delta
+				// covers everything since its cursor anyway
+				for len(ticks) > 0 {
+					<-ticks
+				}
+				fr, changed := s.sim.NextFrame(cur, filter)
+				if !changed {
+					continue
+				}
+				if c.send(RPCResponse{JSONRPC: "2.0", Method: "event", Params: RPCEvent{Subscription: id, Frame: fr}}) != nil {
+					return
+				}
+			}
+		}
+	}()
+	return id, nil
+}
+
+func unsubscribe(c *rpcConn, raw json.RawMessage) (any, error) {
+	var p struct {
+		Subscription string `json:"subscription"`
+	}
+	if err := rpcParams(raw, &p); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	cancel := c.subs[p.Subscription]
+	delete(c.subs, p.Subscription)
+	c.mu.Unlock()
+	if cancel == nil {
+		return nil, fmt.Errorf("subscription %q: %w", p.Subscription, ErrNotFound)
+	}
+	cancel()
+	return true, nil
+}
+
+// --- dispatch ---
+
+// handle answers one message, a request or a batch. It returns nil when
+// there is nothing to send back, i.e. only notifications were received.
+func (s *RPC) handle(c *rpcConn, msg []byte) []byte {
+	msg = bytes.TrimSpace(msg)
+	if len(msg) > 0 && msg[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(msg, &batch); err != nil {
+			return rpcMarshal(rpcFailure(nil, RPCParseError, "parse error: "+err.Error()))
+		}
+		if len(batch) == 0 {
+			return rpcMarshal(rpcFailure(nil, RPCInvalidRequest, "empty batch"))
+		}
+		var out []RPCResponse
+		for _, m := range batch {
+			if r := s.call(c, m); r != nil {
+				out = append(out, *r)
+			}
+		}
+		if len(out) == 0 {
+			return nil
+		}
+		return rpcMarshal(out)
+	}
+	if r := s.call(c, msg); r != nil {
+		return rpcMarshal(*r)
+	}
+	return nil
+}
+
+func (s *RPC) call(c *rpcConn, msg json.RawMessage) *RPCResponse {
+	var req RPCRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		var syn *json.SyntaxError
+		if errors.As(err, &syn) {
+			return rpcFailure(nil, RPCParseError, "parse error: "+err.Error())
+		}
+		return rpcFailure(nil, RPCInvalidRequest, "invalid request: "+err.Error())
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return rpcFailure(req.ID, RPCInvalidRequest, `invalid request: want "jsonrpc": "2.0" and a method`)
+	}
+	if len(req.Params) > 0 && req.Params[0] != '{' && string(req.Params) != "null" {
+		return rpcReply(req.ID, rpcFailure(req.ID, RPCInvalidParams, "params must be an object"))
+	}
+	m := s.methods[req.Method]
+	if m == nil {
+		return rpcReply(req.ID, rpcFailure(req.ID, RPCMethodNotFound, "method not found: "+req.Method))
+	}
+	need := RoleControl
+	if rpcReadOnly[req.Method] {
+		need = RoleRead
+	}
+	var res any
+	var err error
+	p, authed := PrincipalFrom(c.ctx)
+	if authed && !p.Role.Allows(need) {
+		err = denied(p, need)
+	} else if res, err = m(c, req.Params); err == nil && authed && need == RoleControl {
+		s.sim.Audit(p.who(), "rpc "+req.Method)
+	}
+	if err != nil {
+		ae := AsAPIError(err)
+		code := RPCServerError
+		if ae.Code == CodeInvalidParam || ae.Code == CodeInvalidJSON {
+			code = RPCInvalidParams
+		}
+		return rpcReply(req.ID, &RPCResponse{JSONRPC: "2.0", ID: req.ID, Error: &RPCError{Code: code, Message: ae.Message, Data: ae}})
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		return rpcReply(req.ID, rpcFailure(req.ID, RPCInternalError, err.Error()))
+	}
+	return rpcReply(req.ID, &RPCResponse{JSONRPC: "2.0", ID: req.ID, Result: b})
+}
+
+// rpcReply drops the response to a notification.
+func rpcReply(id json.RawMessage, r *RPCResponse) *RPCResponse {
+	if id == nil {
+		return nil
+	}
+	return r
+}
+
+func rpcFailure(id json.RawMessage, code int, msg string) *RPCResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &RPCResponse{JSONRPC: "2.0", ID: id, Error: &RPCError{Code: code, Message: msg}}
+}
+
+func rpcMarshal(v any) []byte {
+	b, _ := json.Marshal(v)
+	return b
+}
+
+// --- transports ---
+
+// ServeHTTP answers one JSON-RPC request or batch per POST.
+func (s *RPC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRPCBody))
+	if err != nil {
+		writeError(w, BadJSON(err))
+		return
+	}
+	out := s.handle(&rpcConn{ctx: r.Context()}, body)
+	if out == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(out, '\n'))
+}
+
+// Serve reads newline-delimited messages from r and writes responses and
+// event notifications to w, one per line, until r ends or ctx is done.
+func (s *RPC) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	var wmu sync.Mutex
+	write := func(b []byte) error {
+		wmu.Lock()
+		defer wmu.Unlock()
+		_, err := w.Write(append(b, '\n'))
+		return err
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxRPCBody)
+	next := func() ([]byte, error) {
+		for sc.Scan() {
+			if len(bytes.TrimSpace(sc.Bytes())) > 0 {
+				return sc.Bytes(), nil
+			}
+		}
+		if sc.Err() != nil {
+			return nil, sc.Err()
+		}
+		return nil, io.EOF
+	}
+	return s.serve(ctx, next, write)
+}
+
+// serve runs one stream connection: next returns each incoming message and
+// write sends one, safely from several goroutines. A clean io.EOF from next
+// ends it without error.
+func (s *RPC) serve(ctx context.Context, next func() ([]byte, error), write func([]byte) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // ends every subscription
+	c := &rpcConn{ctx: ctx, subs: map[string]func(){}}
+	c.send = func(n RPCResponse) error { return write(rpcMarshal(n)) }
+	for ctx.Err() == nil {
+		msg, err := next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if out := s.handle(c, msg); out != nil {
+			if err := write(out); err != nil {
+				return err
+			}
+		}
+	}
+	return ctx.Err()
+}
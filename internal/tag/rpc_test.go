@@ -0,0 +1,139 @@
+package tag
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRPCDispatch(t *testing.T) {
+	rpc := NewRPC(NewSimulation())
+	for _, tc := range []struct {
+		name, msg string
+		code      int    // expected error code, 0 for success
+		id        string // expected response ID; "" means no response at all
+	}{
+		{"call", `{"jsonrpc": "2.0", "id": 1, "method": "state"}`, 0, "1"},
+		{"string id", `{"jsonrpc": "2.0", "id": "a", "method": "params.get"}`, 0, `"a"`},
+		{"params object", `{"jsonrpc": "2.0", "id": 2, "method": "step", "params": {"n": 2}}`, 0, "2"},
+		{"notification", `{"jsonrpc": "2.0", "method": "step"}`, 0, ""},
+		{"failing notification", `{"jsonrpc": "2.0", "method": "nowhere"}`, 0, ""},
+		{"parse error", `{"jsonrpc": "2.0", "id": 3`, RPCParseError, "null"},
+		{"not an object", `"state"`, RPCInvalidRequest, "null"},
+		{"missing version", `{"id": 4, "method": "state"}`, RPCInvalidRequest, "4"},
+		{"missing method", `{"jsonrpc": "2.0", "id": 5}`, RPCInvalidRequest, "5"},
+		{"unknown method", `{"jsonrpc": "2.0", "id": 6, "method": "nowhere"}`, RPCMethodNotFound, "6"},
+		{"positional params", `{"jsonrpc": "2.0", "id": 7, "method": "step", "params": [2]}`, RPCInvalidParams, "7"},
+		{"unknown param", `{"jsonrpc": "2.0", "id": 8, "method": "step", "params": {"count": 2}}`, RPCInvalidParams, "8"},
+		{"param out of range", `{"jsonrpc": "2.0", "id": 9, "method": "step", "params": {"n": 0}}`, RPCInvalidParams, "9"},
+		{"bad value", `{"jsonrpc": "2.0", "id": 10, "method": "params.set", "params": {"dt": -1}}`, RPCInvalidParams, "10"},
+		{"simulation error", `{"jsonrpc": "2.0", "id": 11, "method": "bubbles.get", "params": {"id": "nope"}}`, RPCServerError, "11"},
+		{"subscribe over HTTP", `{"jsonrpc": "2.0", "id": 12, "method": "subscribe"}`, RPCServerError, "12"},
+		{"empty batch", `[]`, RPCInvalidRequest, "null"},
+	} {
+		out := rpc.handle(&rpcConn{ctx: context.Background()}, []byte(tc.msg))
+		if tc.id == "" {
+			if out != nil {
+				t.Errorf("%s: answered %s", tc.name, out)
+			}
+			continue
+		}
+		var resp RPCResponse
+		if err := json.Unmarshal(out, &resp); err != nil {
+			t.Errorf("%s: %s: %v", tc.name, out, err)
+			continue
+		}
+		if string(resp.ID) != tc.id {
+			t.Errorf("%s: id %s, want %s", tc.name, resp.ID, tc.id)
+		}
+		switch {
+		case tc.code == 0 && resp.Error != nil:
+			t.Errorf("%s: %+v", tc.name, resp.Error)
+		case tc.code == 0 && resp.Result == nil:
+			t.Errorf("%s: no result", tc.name)
+		case tc.code != 0 && (resp.Error == nil || resp.Error.Code != tc.code):
+			t.Errorf("%s: %s, want error %d", tc.name, out, tc.code)
+		}
+	}
+}
+
+func TestRPCBatch(t *testing.T) {
+	rpc := NewRPC(NewSimulation())
+	out := rpc.handle(&rpcConn{ctx: context.Background()}, []byte(`[
+		{"jsonrpc": "2.0", "id": 1, "method": "step"},
+		{"jsonrpc": "2.0", "method": "step"},
+		{"jsonrpc": "2.0", "id": 2, "method": "nowhere"},
+		{"jsonrpc": "2.0", "id": 3, "method": "state"}
+	]`))
+	var resps []RPCResponse
+	if err := json.Unmarshal(out, &resps); err != nil {
+		t.Fatalf("%s: %v", out, err)
+	}
+	if len(resps) != 3 {
+		t.Fatalf("%d responses to a batch with three calls and a notification", len(resps))
+	}
+	var st SimState
+	json.Unmarshal(resps[2].Result, &st)
+	if resps[1].Error == nil || st.Step != 2 {
+		t.Fatalf("batch answered %s", out)
+	}
+	if out := rpc.handle(&rpcConn{ctx: context.Background()}, []byte(`[{"jsonrpc": "2.0", "method": "step"}]`)); out != nil {
+		t.Fatalf("batch of notifications answered %s", out)
+	}
+}
+
+func TestRPCRoles(t *testing.T) {
+	sim := NewSimulation()
+	rpc := NewRPC(sim)
+	call := func(p Principal, method string) *RPCError {
+		msg := `{"jsonrpc": "2.0", "id": 1, "method": "` + method + `"}`
+		var resp RPCResponse
+		json.Unmarshal(rpc.handle(&rpcConn{ctx: WithPrincipal(context.Background(), p)}, []byte(msg)), &resp)
+		return resp.Error
+	}
+	reader, operator := Principal{Name: "dash", Role: RoleRead}, Principal{Name: "ops", Role: RoleControl}
+	if err := call(reader, "state"); err != nil {
+		t.Fatalf("reader reading: %+v", err)
+	}
+	if err := call(reader, "step"); err == nil || err.Data == nil || err.Data.Code != CodeForbidden {
+		t.Fatalf("reader stepping: %+v", err)
+	}
+	if err := call(operator, "step"); err != nil {
+		t.Fatalf("operator stepping: %+v", err)
+	}
+	if sim.State().Step != 1 {
+		t.Fatalf("step %d; only the operator's call should have stepped", sim.State().Step)
+	}
+	var audited []string
+	for _, r := range sim.Snapshot().Receipts {
+		if r.Type == RAudit {
+			audited = append(audited, r.Subject+": "+r.Note)
+		}
+	}
+	if got := strings.Join(audited, "\n"); got != "ops: rpc step" {
+		t.Fatalf("audit trail %q", got)
+	}
+}
+
+func TestRPCServeStream(t *testing.T) {
+	rpc := NewRPC(NewSimulation())
+	in := strings.NewReader(`{"jsonrpc": "2.0", "id": 1, "method": "step", "params": {"n": 3}}` + "\n\n" +
+		`{"jsonrpc": "2.0", "method": "step"}` + "\n" +
+		`{"jsonrpc": "2.0", "id": 2, "method": "state"}` + "\n")
+	var out strings.Builder
+	if err := rpc.Serve(context.Background(), in, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("%d response lines:\n%s", len(lines), out.String())
+	}
+	var resp RPCResponse
+	var st SimState
+	json.Unmarshal([]byte(lines[1]), &resp)
+	json.Unmarshal(resp.Result, &st)
+	if string(resp.ID) != "2" || st.Step != 4 {
+		t.Fatalf("last response %s", lines[1])
+	}
+}
@@ -0,0 +1,99 @@
+package tag
+
+import "fmt"
+
+// MaxRunSteps caps a single RunUntil call.
+const MaxRunSteps = 100000
+
+// Condition stops a run once Test reports true for the summary so far.
+type Condition struct {
+	Name string
+	Test func(RunSummary) bool
+}
+
+// Reconciled stops when the meta bubble and chaostote have collapsed.
+func Reconciled() Condition {
+	return Condition{"reconciled", func(s RunSummary) bool { return s.ReconciledStep > 0 || s.Collapsed }}
+}
+
+// MetaBorn stops when a meta totebubble is born.
+func MetaBorn() Condition {
+	return Condition{"meta_born", func(s RunSummary) bool { return s.MetaBornStep > 0 }}
+}
+
+// MaxSteps stops after n steps.
+func MaxSteps(n int) Condition {
+	return Condition{"max_steps", func(s RunSummary) bool { return s.Steps >= n }}
+}
+
+// ErrorBelow stops once total chaostote error drops under threshold.
+func ErrorBelow(threshold float64) Condition {
+	return Condition{"error_below", func(s RunSummary) bool { return s.Steps > 0 && s.TotalError < threshold }}
+}
+
+// Custom wraps an arbitrary predicate.
+func Custom(name string, fn func(RunSummary) bool) Condition {
+	return Condition{name, fn}
+}
+
+// RunUntil steps until any condition holds or limit steps have run.
+// The summary's Reason names the condition that stopped the run.
+func (s *Simulation) RunUntil(limit int, conds ...Condition) (RunSummary, error) {
+	if limit <= 0 || limit > MaxRunSteps {
+		return RunSummary{}, fmt.Errorf("step limit must be in 1..%d", MaxRunSteps)
+	}
+	t := s.beginTally()
+	for {
+		for _, c := range conds {
+			if c.Test(t.sum) {
+				t.sum.Reason = c.Name
+				return t.sum, nil
+			}
+		}
+		if t.sum.Steps >= limit {
+			t.sum.Reason = "max_steps"
+			return t.sum, nil
+		}
+		if err := t.step(s); err != nil {
+			return t.sum, err
+		}
+	}
+}
+
+// RunRequest is the body of /api/tag/run. Steps alone runs a fixed count;
+// Until names conditions ("reconciled", "meta_born") to stop on earlier.
+type RunRequest struct {
+	Steps      int      `json:"steps,omitempty"`
+	Until      []string `json:"until,omitempty"`
+	ErrorBelow *float64 `json:"error_below,omitempty"`
+	MaxSteps   int      `json:"max_steps,omitempty"`
+}
+
+// Conditions turns a request into a step limit and stop conditions.
+func (req RunRequest) Conditions() (int, []Condition, error) {
+	limit := req.MaxSteps
+	if req.Steps > 0 && (limit == 0 || req.Steps < limit) {
+		limit = req.Steps
+	}
+	var conds []Condition
+	for _, name := range req.Until {
+		switch name {
+		case "reconciled":
+			conds = append(conds, Reconciled())
+		case "meta_born":
+			conds = append(conds, MetaBorn())
+		default:
+			return 0, nil, fmt.Errorf("unknown condition %q", name)
+		}
+	}
+	if req.ErrorBelow != nil {
+		conds = append(conds, ErrorBelow(*req.ErrorBelow))
+	}
+	if limit == 0 {
+		if len(conds) == 0 {
+			return 0, nil, fmt.Errorf("run needs steps, max_steps or a condition")
+		}
+		limit = MaxRunSteps
+	}
+	return limit, conds, nil
+}
@@ -0,0 +1,40 @@
+package tag
+
+import "testing"
+
+func TestRunUntilCountsOnlyItsOwnSteps(t *testing.T) {
+	sim := NewSimulation()
+	others := map[int]bool{}
+	interleave := Custom("never", func(RunSummary) bool {
+		sim.Step() // another caller steps between each of the run's steps
+		others[sim.State().Step] = true
+		return false
+	})
+	sum, err := sim.RunUntil(20, interleave)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Steps != 20 {
+		t.Fatalf("run took %d steps, want 20", sum.Steps)
+	}
+
+	want := map[ReceiptType]int{}
+	for _, r := range sim.Snapshot().Receipts {
+		if r.Step >= sum.FromStep && r.Step <= sum.ToStep && !others[r.Step] {
+			want[r.Type]++
+		}
+	}
+	for typ, n := range want {
+		if sum.Receipts[typ] != n {
+			t.Errorf("%s: counted %d, the run's own steps made %d", typ, sum.Receipts[typ], n)
+		}
+	}
+	for typ, n := range sum.Receipts {
+		if want[typ] == 0 {
+			t.Errorf("%s: counted %d from steps the run did not take", typ, n)
+		}
+	}
+	if others[sum.MetaBornStep] {
+		t.Errorf("meta birth at step %d belongs to another caller", sum.MetaBornStep)
+	}
+}
@@ -0,0 +1,81 @@
+package tag
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEnvelopeSignVerify(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	sum := RunSummary{FromStep: 1, ToStep: 9, Steps: 8, Reason: "max_steps"}
+	env, err := Sign(KindSummary, sum, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.Verify(pub); err != nil {
+		t.Fatalf("signer's key: %v", err)
+	}
+	if err := env.Verify(nil); err != nil {
+		t.Fatalf("embedded key: %v", err)
+	}
+	var back RunSummary
+	if err := env.Decode(&back); err != nil || back.ToStep != 9 || back.Reason != "max_steps" {
+		t.Fatalf("decoded %+v, %v", back, err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		spoil func(*Envelope)
+		pub   ed25519.PublicKey
+	}{
+		{"other key", func(*Envelope) {}, other},
+		{"payload", func(e *Envelope) { e.Payload = []byte(`{"steps":1000}`) }, nil},
+		{"kind", func(e *Envelope) { e.Kind = KindCheckpoint }, nil},
+		{"date", func(e *Envelope) { e.Signed = e.Signed.Add(-time.Hour) }, nil},
+		{"signature", func(e *Envelope) {
+			flip := map[byte]string{'0': "1"}[e.Sig[0]]
+			if flip == "" {
+				flip = "0"
+			}
+			e.Sig = flip + e.Sig[1:]
+		}, nil},
+	} {
+		e := *env
+		tc.spoil(&e)
+		if err := e.Verify(tc.pub); !errors.Is(err, ErrBadSignature) {
+			t.Errorf("%s: %v, want ErrBadSignature", tc.name, err)
+		}
+	}
+	e := *env
+	e.Key = "not hex"
+	if err := e.Verify(nil); err == nil {
+		t.Error("invalid embedded key accepted")
+	}
+}
+
+func TestKeyFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tag.key")
+	pub, err := GenerateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := LoadPrivateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadPublicKey(path + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Equal(pub) || !priv.Public().(ed25519.PublicKey).Equal(pub) {
+		t.Fatal("key files do not hold one key pair")
+	}
+	if _, err := LoadPublicKey(path); err == nil {
+		t.Error("private key file accepted as a public key")
+	}
+}
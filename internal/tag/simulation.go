@@ -1,10 +1,8 @@
 package tag
 
 import (
-	"encoding/json"
-	"math"
+	"fmt"
 	"sync"
-	"time"
 )
 
 // Simulation wraps the existing Chaostote + chain structures
@@ -12,17 +10,44 @@ import (
 type Simulation struct {
 	mu        sync.Mutex
 	StepNum   int
+	Time      float64
 	Chi       *Chaostote
 	Root      *ToteBubble
 	ErrRoot   *ErrorBubble
 	Meta      *ToteBubble
-	Receipts  []Receipt
+	Ledger    *Ledger
 	ParamsCfg Params
+	Drivers   []Binding
+
+	// StaleAfter is the sample gap, in steps, after which an observed bubble is reported stale.
+	StaleAfter int
+	pending    []Observation
+	tracks     map[string]*ingestTrack
+	history    map[string][]BubbleSample
+
+	obs       observers
+	unsent    []event
+	collapsed bool // field collapsed and nothing has disturbed it since
+	clock     *Clock
+	causes    *causalIndex
+	tt        *timeline
+
+	layoutKey   string // topology the cached layout was computed for
+	layoutCache map[string][2]float64
+	journal     *Journal
 }
 
 // --- construction and setup ---
 
 func NewSimulation() *Simulation {
+	s := &Simulation{tt: &timeline{every: DefaultRewindEvery, keep: DefaultRewindKeep}}
+	s.reset()
+	s.unsent = nil // nobody is listening yet
+	return s
+}
+
+// reset rebuilds the default A→B→C→D scenario in place.
+func (s *Simulation) reset() {
 	A := chain("A", "B", "C", "D")
 	A.State, A.Demand, A.Tolerance = 0, 0, 0.01
 	B := A.Child
@@ -32,82 +57,243 @@ func NewSimulation() *Simulation {
 	D := C.Child
 	D.State, D.Demand, D.Tolerance = 1.5, 1.5, 0.05
 
-	chi := &Chaostote{ID: "Χ", Viscosity: 0.05}
-	rootErr := SpawnErrorChain(B)
+	s.StepNum = 0
+	s.Time = 0
+	s.collapsed = false
+	s.Chi = &Chaostote{ID: "Χ", Viscosity: 0.05}
+	s.Root = A
+	s.ErrRoot = SpawnErrorChain(B)
+	s.Meta = nil
+	if s.Ledger == nil {
+		s.Ledger = NewLedger(DefaultRetention)
+	}
+	s.Ledger.Clear()
+	if s.causes == nil {
+		s.causes = newCausalIndex()
+	}
+	s.causes.clear()
+	s.commit(Receipt{Step: 0, Type: RSpawnChain, Subject: "B…D.err", Note: "spawned error mirror chain"})
+	s.ParamsCfg = Params{Viscosity: 0.05, Limit: 0.5, Dt: 1.0}
+	// keep A’s demand on B constant unless a caller replaces the driver
+	s.Drivers = []Binding{{Bubble: "B", Field: FieldDemand, Driver: Constant{V: 1.6}}}
+	s.StaleAfter = DefaultStaleAfter
+	s.pending = nil
+	s.tracks = map[string]*ingestTrack{}
+	s.history = map[string][]BubbleSample{}
+	if s.tt != nil {
+		s.tt.restart(s)
+	}
+}
+
+// Attach binds a driver to a bubble field, replacing any existing driver on that field.
+func (s *Simulation) Attach(bubble string, f Field, d Driver) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if findBubble(s.Root, bubble) == nil {
+		return fmt.Errorf("unknown bubble %q", bubble)
+	}
+	if f != FieldState && f != FieldDemand {
+		return fmt.Errorf("unknown field %q", f)
+	}
+	if err := validateDriver(d); err != nil {
+		return err
+	}
+	switch spec, err := EncodeDriver(d); {
+	case err == nil:
+		if err := s.journalOp(OpAttach, attachArgs{Bubble: bubble, Field: f, Driver: &spec}); err != nil {
+			return err
+		}
+	case s.journal != nil:
+		return fmt.Errorf("journaled simulations need a built-in driver: %w", err)
+	case s.tt != nil:
+		// the timeline cannot replay a driver it cannot encode
+		s.tt.forget()
+	}
+	s.detach(bubble, f)
+	s.Drivers = append(s.Drivers, Binding{Bubble: bubble, Field: f, Driver: d})
+	s.collapsed = false
+	return nil
+}
 
-	return &Simulation{
-		Chi:       chi,
-		Root:      A,
-		ErrRoot:   rootErr,
-		ParamsCfg: Params{Viscosity: 0.05, Limit: 0.5, Dt: 1.0},
+// Detach removes the driver bound to a bubble field, if any.
+func (s *Simulation) Detach(bubble string, f Field) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.journalOp(OpDetach, attachArgs{Bubble: bubble, Field: f}) != nil {
+		return
 	}
+	s.detach(bubble, f)
+}
+
+func (s *Simulation) detach(bubble string, f Field) {
+	kept := s.Drivers[:0]
+	for _, b := range s.Drivers {
+		if b.Bubble != bubble || b.Field != f {
+			kept = append(kept, b)
+		}
+	}
+	s.Drivers = kept
 }
 
 // --- control ---
 
 func (s *Simulation) Step() {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	defer s.unlock()
+	if s.journalOp(OpStep, nil) != nil {
+		return // State reports the journal error
+	}
+	s.step()
+}
 
+// step advances one tick; callers hold s.mu.
+func (s *Simulation) step() {
 	s.StepNum++
 	step := s.StepNum
 	dt := s.ParamsCfg.Dt
+	s.Time += dt
+	var rs []Receipt
 
-	B := s.Root.Child
-	B.Demand = 1.6 // keep A’s demand constant
+	applyDrivers(s.Root, s.Drivers, step, s.Time, &rs)
+	s.applyObservations(step, &rs)
 
-	s.Chi.InjectChain(s.ErrRoot, &s.Receipts, step)
-	s.Chi.Diffuse(dt, &s.Receipts, step)
+	s.Chi.InjectChain(s.ErrRoot, &rs, step)
+	s.Chi.Diffuse(dt, &rs, step)
 
 	if s.Meta == nil {
-		if m := s.Chi.CheckMetaBirth(s.ParamsCfg.Limit, &s.Receipts, step); m != nil {
+		if m := s.Chi.CheckMetaBirth(s.ParamsCfg.Limit, &rs, step); m != nil {
 			s.Meta = m
 		}
 	} else {
 		draw := s.Meta.State * 0.25
 		if draw > 0 {
 			used := DrainChaostote(s.Chi, draw)
+			before := s.Meta.State
 			s.Meta.State -= used
-			_, _ = BackfeedAndReconcile(s.ErrRoot, used, &s.Receipts, step)
+			if used > 0 {
+				rs = append(rs, Receipt{
+					Step: step, Type: RDrain, Subject: s.Meta.ID,
+					Note: "meta drained chaostote", Payload: change("meta_energy", before, s.Meta.State),
+				})
+			}
+			if s.ErrRoot != nil { // every error bubble may have been removed
+				_, _ = BackfeedAndReconcile(s.ErrRoot, used, &rs, step)
+			}
 		}
 		if s.Chi.TotalError() < 1e-3 && s.Meta.State < 1e-3 {
-			s.Receipts = append(s.Receipts, Receipt{
-				Step:    step,
-				Type:    RReconcile,
-				Subject: s.Meta.ID,
-				Note:    "meta & chaostote reconciled; field collapsed",
-			})
+			if !s.collapsed {
+				rs = append(rs, Receipt{
+					Step:    step,
+					Type:    RReconcile,
+					Subject: s.Meta.ID,
+					Note:    "meta & chaostote reconciled; field collapsed",
+				})
+				s.collapsed = true
+			}
+		} else {
+			s.collapsed = false
 		}
 	}
+	s.recordHistory(step)
+	s.commit(rs...)
+	s.Ledger.Prune(step)
+	if s.tt != nil && step%s.tt.every == 0 {
+		s.tt.mark(s)
+	}
+
+	st := s.state()
+	st.Receipts = rs
+	s.unsent = append(s.unsent, event{state: &st})
 }
 
-func (s *Simulation) Reset() {
+// Idle reports whether stepping would change nothing: the field has
+// collapsed, no observations are queued and every driver is constant.
+func (s *Simulation) Idle() bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	*s = *NewSimulation()
+	if !s.collapsed || len(s.pending) > 0 {
+		return false
+	}
+	for _, b := range s.Drivers {
+		if _, ok := b.Driver.(Constant); !ok {
+			return false
+		}
+	}
+	return true
 }
 
-func (s *Simulation) UpdateParams(p Params) {
+func (s *Simulation) Reset() {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	if p.Viscosity != 0 {
-		s.Chi.Viscosity = p.Viscosity
-		s.ParamsCfg.Viscosity = p.Viscosity
+	defer s.unlock()
+	if s.journalOp(OpReset, nil) != nil {
+		return
 	}
-	if p.Limit != 0 {
-		s.ParamsCfg.Limit = p.Limit
+	s.reset()
+}
+
+// SetRetention changes how many receipts the ledger keeps.
+func (s *Simulation) SetRetention(r Retention) error {
+	if err := r.Validate(); err != nil {
+		return err
 	}
-	if p.Dt != 0 {
-		s.ParamsCfg.Dt = p.Dt
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.journalOp(OpRetention, r); err != nil {
+		return err
+	}
+	s.Ledger.SetRetention(r)
+	return nil
+}
+
+// SetHashChain turns hash chaining of new receipts on or off.
+func (s *Simulation) SetHashChain(on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.journalOp(OpHashChain, on) != nil {
+		return
 	}
+	s.Ledger.SetChained(on)
 }
 
-func (s *Simulation) Params() Params { return s.ParamsCfg }
+// HashChain reports whether receipts are chained and the current chain head.
+func (s *Simulation) HashChain() (bool, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Ledger.Chained(), s.Ledger.Head()
+}
+
+func (s *Simulation) Retention() Retention {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Ledger.Retention()
+}
+
+// Receipts queries the ledger.
+func (s *Simulation) Receipts(q Query) Page {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Ledger.Query(q)
+}
 
 func (s *Simulation) Snapshot() SimState {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return SimState{
+	st := s.state()
+	st.Receipts = s.Ledger.All()
+	return st
+}
+
+// State is Snapshot without the receipt log.
+func (s *Simulation) State() SimState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state()
+}
+
+// state summarises the simulation without receipts; callers hold s.mu.
+func (s *Simulation) state() SimState {
+	st := SimState{
+		Schema:     SchemaVersion,
 		Step:       s.StepNum,
 		TotalError: s.Chi.TotalError(),
 		MetaEnergy: func() float64 {
@@ -116,49 +302,9 @@ func (s *Simulation) Snapshot() SimState {
 			}
 			return 0
 		}(),
-		Receipts: s.Receipts,
 	}
-}
-
-// Stream runs physics at 30 Hz but only sends state to the GUI 5 fps (~every 200 ms).
-func (s *Simulation) Stream() <-chan []byte {
-	out := make(chan []byte)
-
-	go func() {
-		physTicker := time.NewTicker(time.Second / 30)       // 30 Hz physics
-		sendTicker := time.NewTicker(200 * time.Millisecond) // 5 Hz output
-		defer physTicker.Stop()
-		defer sendTicker.Stop()
-
-		var lastStep int
-		var lastTotal, lastMeta float64
-
-		for {
-			select {
-			case <-physTicker.C:
-				s.Step()
-
-			case <-sendTicker.C:
-				state := s.Snapshot()
-
-				// Only send if something actually changed
-				if state.Step != lastStep ||
-					math.Abs(state.TotalError-lastTotal) > 1e-5 ||
-					math.Abs(state.MetaEnergy-lastMeta) > 1e-5 {
-
-					b, _ := json.Marshal(state)
-					select {
-					case out <- b:
-					default:
-					} // drop frame if busy
-
-					lastStep = state.Step
-					lastTotal = state.TotalError
-					lastMeta = state.MetaEnergy
-				}
-			}
-		}
-	}()
-
-	return out
+	if err := s.journalErr(); err != nil {
+		st.JournalError = err.Error()
+	}
+	return st
 }
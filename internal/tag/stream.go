@@ -0,0 +1,158 @@
+package tag
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	keyframeEvery    = 25   // frames between keyframes (~5 s at 5 Hz)
+	maxFrameReceipts = 5000 // newest receipts kept when a delta would be larger
+)
+
+// StreamFrame is one SSE message. Keyframes carry every bubble; deltas carry
+// only bubbles that changed and receipts committed since the previous frame.
+type StreamFrame struct {
+	Cursor     uint64       `json:"cursor"`
+	Step       int          `json:"step"`
+	Keyframe   bool         `json:"keyframe,omitempty"`
+	TotalError float64      `json:"total_error"`
+	MetaEnergy float64      `json:"meta_energy"`
+	Bubbles    []BubbleInfo `json:"bubbles,omitempty"`
+	Removed    []string     `json:"removed,omitempty"`
+	Receipts   []Receipt    `json:"receipts,omitempty"`
+	Truncated  bool         `json:"truncated,omitempty"` // older receipts of this delta were dropped
+	Frame      *Frame       `json:"frame,omitempty"`     // drawable frame, for cursors that ask for it
+}
+
+// ReceiptFilter selects receipts by type and subject; empty sets match everything.
+type ReceiptFilter struct {
+	Types    map[ReceiptType]bool
+	Subjects map[string]bool
+}
+
+// ParseReceiptFilter reads comma-separated "types" and "subject" query parameters.
+func ParseReceiptFilter(q url.Values) ReceiptFilter {
+	var f ReceiptFilter
+	for _, t := range splitList(q.Get("types")) {
+		if f.Types == nil {
+			f.Types = map[ReceiptType]bool{}
+		}
+		f.Types[ReceiptType(t)] = true
+	}
+	for _, sub := range splitList(q.Get("subject")) {
+		if f.Subjects == nil {
+			f.Subjects = map[string]bool{}
+		}
+		f.Subjects[sub] = true
+	}
+	return f
+}
+
+func (f ReceiptFilter) Match(r Receipt) bool {
+	return (f.Types == nil || f.Types[r.Type]) && (f.Subjects == nil || f.Subjects[r.Subject])
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// StreamCursor remembers what one client has already been sent.
+type StreamCursor struct {
+	Seq       uint64 // receipts before this cursor have been delivered
+	WithFrame bool   // attach a full Frame to every message
+	frames    int
+	step      int
+	bubbles   map[string]BubbleInfo
+}
+
+// NewStreamCursor resumes after a cursor previously sent to the client (0 for a fresh client).
+func NewStreamCursor(seq uint64) *StreamCursor {
+	return &StreamCursor{Seq: seq, step: -1}
+}
+
+// Cursor returns the current receipt cursor, for clients that start "from now".
+func (s *Simulation) Cursor() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Ledger.Seq()
+}
+
+// CursorAfterStep returns the cursor just before the first receipt of a step later than step.
+func (s *Simulation) CursorAfterStep(step int) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Ledger.AfterStep(step)
+}
+
+// NextFrame builds the next frame for a client and advances its cursor.
+// It reports false when nothing changed since the previous frame.
+func (s *Simulation) NextFrame(c *StreamCursor, f ReceiptFilter) (StreamFrame, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.state()
+	l := s.Ledger
+	fr := StreamFrame{Cursor: l.Seq(), Step: st.Step, TotalError: st.TotalError, MetaEnergy: st.MetaEnergy}
+
+	from := c.Seq
+	if from < l.Base() || from > l.Seq() { // reset or unknown cursor: resend what is retained
+		from = l.Base()
+		c.bubbles = nil
+	}
+	fr.Keyframe = c.bubbles == nil || c.frames%keyframeEvery == 0 || st.Step < c.step
+
+	rs := l.Since(from)
+	for i := range rs {
+		if f.Match(rs[i]) {
+			fr.Receipts = append(fr.Receipts, rs[i])
+		}
+	}
+	if len(fr.Receipts) > maxFrameReceipts {
+		fr.Receipts = fr.Receipts[len(fr.Receipts)-maxFrameReceipts:]
+		fr.Truncated = true
+	}
+
+	seen := map[string]bool{}
+	next := map[string]BubbleInfo{}
+	for t := s.Root; t != nil; t = t.Child {
+		bi := s.info(t)
+		next[bi.ID], seen[bi.ID] = bi, true
+		if prev, ok := c.bubbles[bi.ID]; fr.Keyframe || !ok || !sameBubble(prev, bi) {
+			fr.Bubbles = append(fr.Bubbles, bi)
+		}
+	}
+	if !fr.Keyframe {
+		for id := range c.bubbles {
+			if !seen[id] {
+				fr.Removed = append(fr.Removed, id)
+			}
+		}
+		sort.Strings(fr.Removed)
+	}
+
+	changed := fr.Keyframe || len(rs) > 0 || len(fr.Bubbles) > 0 || len(fr.Removed) > 0 || st.Step != c.step
+	if c.WithFrame && changed {
+		frame := s.frame()
+		fr.Frame = &frame
+	}
+	c.Seq, c.step, c.bubbles = l.Seq(), st.Step, next
+	if changed {
+		c.frames++
+	}
+	return fr, changed
+}
+
+func sameBubble(a, b BubbleInfo) bool {
+	return a.Parent == b.Parent && a.Child == b.Child &&
+		a.State == b.State && a.Demand == b.Demand && a.Tolerance == b.Tolerance &&
+		a.Error == b.Error && a.Culprit == b.Culprit && a.Resolved == b.Resolved &&
+		strings.Join(a.Drivers, ",") == strings.Join(b.Drivers, ",")
+}
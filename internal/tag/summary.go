@@ -0,0 +1,76 @@
+package tag
+
+// RunSummary describes what happened over a span of steps.
+type RunSummary struct {
+	FromStep       int                 `json:"from_step"`
+	ToStep         int                 `json:"to_step"`
+	Steps          int                 `json:"steps"`
+	MetaBornStep   int                 `json:"meta_born_step,omitempty"`
+	ReconciledStep int                 `json:"reconciled_step,omitempty"`
+	PeakError      float64             `json:"peak_error"`
+	TotalError     float64             `json:"total_error"`
+	MetaEnergy     float64             `json:"meta_energy"`
+	Collapsed      bool                `json:"collapsed"`
+	Receipts       map[ReceiptType]int `json:"receipts"`
+	Reason         string              `json:"reason,omitempty"` // why a run stopped
+}
+
+// tally accumulates a RunSummary while a caller steps the simulation.
+type tally struct {
+	sum  RunSummary
+	seen uint64 // ledger cursor of the next receipt to count
+}
+
+func (s *Simulation) beginTally() *tally {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := &tally{seen: s.Ledger.Seq()}
+	t.sum.FromStep = s.StepNum
+	t.sum.Receipts = map[ReceiptType]int{}
+	t.observe(s)
+	return t
+}
+
+// observe folds in everything since the last call; callers hold s.mu.
+func (t *tally) observe(s *Simulation) {
+	for _, r := range s.Ledger.Since(t.seen) {
+		t.sum.Receipts[r.Type]++
+		switch {
+		case r.Type == RMetaBirth && t.sum.MetaBornStep == 0:
+			t.sum.MetaBornStep = r.Step
+		case r.Type == RReconcile && s.Meta != nil && r.Subject == s.Meta.ID && t.sum.ReconciledStep == 0:
+			t.sum.ReconciledStep = r.Step
+		}
+	}
+	t.seen = s.Ledger.Seq()
+	t.sum.ToStep = s.StepNum
+	t.sum.TotalError = s.Chi.TotalError()
+	if t.sum.TotalError > t.sum.PeakError {
+		t.sum.PeakError = t.sum.TotalError
+	}
+	t.sum.Collapsed = s.collapsed
+	t.sum.MetaEnergy = 0
+	if s.Meta != nil {
+		t.sum.MetaEnergy = s.Meta.State
+	}
+}
+
+// step takes one step for the caller and folds it in. Only these steps
+// count, and the first one fixes FromStep, so steps the clock takes
+// alongside do not eat into the caller's limit. Receipts are counted from
+// this step alone: the cursor skips whatever other callers added since.
+func (t *tally) step(s *Simulation) error {
+	s.mu.Lock()
+	defer s.unlock()
+	if err := s.journalOp(OpStep, nil); err != nil {
+		return err
+	}
+	if t.sum.Steps == 0 {
+		t.sum.FromStep = s.StepNum
+	}
+	t.seen = s.Ledger.Seq()
+	s.step()
+	t.sum.Steps++
+	t.observe(s)
+	return nil
+}
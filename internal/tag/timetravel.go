@@ -0,0 +1,306 @@
+package tag
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Rewind defaults: an in-memory checkpoint every DefaultRewindEvery steps,
+// keeping the newest DefaultRewindKeep of them. Any step since the oldest kept one can be
+// reached by replaying the commands recorded after it.
+const (
+	DefaultRewindEvery = 50
+	DefaultRewindKeep  = 40
+)
+
+// rewindPoint is a checkpoint plus every command applied after it.
+type rewindPoint struct {
+	cp   *Checkpoint
+	tail []Command
+}
+
+type timeline struct {
+	every, keep int
+	points      []*rewindPoint
+}
+
+// record appends a command to the newest point's tail; callers hold s.mu.
+func (tl *timeline) record(op string, args any) {
+	if len(tl.points) == 0 {
+		return
+	}
+	c := Command{Op: op}
+	if args != nil {
+		b, err := json.Marshal(args)
+		if err != nil {
+			return
+		}
+		c.Args = b
+	}
+	p := tl.points[len(tl.points)-1]
+	p.tail = append(p.tail, c)
+}
+
+// mark starts a new point; callers hold s.mu.
+func (tl *timeline) mark(s *Simulation) {
+	cp, err := s.checkpoint()
+	if err != nil {
+		// custom drivers cannot be captured; rewinding stops at the last good point
+		return
+	}
+	tl.points = append(tl.points, &rewindPoint{cp: cp})
+	if n := len(tl.points) - tl.keep; tl.keep > 0 && n > 0 {
+		tl.points = append([]*rewindPoint(nil), tl.points[n:]...)
+	}
+}
+
+// forget drops every point, so nothing before now can be rewound to. Points
+// are taken again once the simulation can be checkpointed.
+func (tl *timeline) forget() {
+	tl.points = nil
+}
+
+// restart drops every point and starts over from the current state.
+func (tl *timeline) restart(s *Simulation) {
+	tl.points = nil
+	tl.mark(s)
+}
+
+// --- rewinding ---
+
+// SetRewind changes how often rewind points are taken and how many are kept.
+// every <= 0 disables rewinding.
+func (s *Simulation) SetRewind(every, keep int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if every <= 0 {
+		s.tt = nil
+		return
+	}
+	if s.tt == nil {
+		s.tt = &timeline{}
+		s.tt.restart(s)
+	}
+	s.tt.every, s.tt.keep = every, keep
+}
+
+// RewindRange is the span of steps Rewind can currently reach.
+type RewindRange struct {
+	From   int   `json:"from"`
+	To     int   `json:"to"`
+	Points []int `json:"points"` // steps with a stored checkpoint
+}
+
+func (s *Simulation) RewindRange() RewindRange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rr := RewindRange{From: s.StepNum, To: s.StepNum, Points: []int{}}
+	if s.tt == nil {
+		return rr
+	}
+	for _, p := range s.tt.points {
+		rr.Points = append(rr.Points, p.cp.Step)
+	}
+	if len(rr.Points) > 0 {
+		rr.From = rr.Points[0]
+	}
+	return rr
+}
+
+// stateAt rebuilds the checkpoint of an earlier step and reports the point it
+// started from and how many of its tail commands were replayed.
+func (s *Simulation) stateAt(step int) (*Checkpoint, *rewindPoint, int, error) {
+	s.mu.Lock()
+	if s.tt == nil {
+		s.mu.Unlock()
+		return nil, nil, 0, fmt.Errorf("rewinding is disabled")
+	}
+	if len(s.tt.points) == 0 {
+		s.mu.Unlock()
+		return nil, nil, 0, fmt.Errorf("no rewind point yet (a custom driver cannot be checkpointed)")
+	}
+	if step > s.StepNum {
+		s.mu.Unlock()
+		return nil, nil, 0, fmt.Errorf("step %d is in the future (now %d)", step, s.StepNum)
+	}
+	pts := s.tt.points
+	i := sort.Search(len(pts), func(i int) bool { return pts[i].cp.Step > step }) - 1
+	if i < 0 {
+		s.mu.Unlock()
+		return nil, nil, 0, fmt.Errorf("step %d is older than the oldest rewind point (%d)", step, pts[0].cp.Step)
+	}
+	p := pts[i]
+	tail := append([]Command(nil), p.tail...)
+	s.mu.Unlock()
+
+	sim, err := FromCheckpoint(p.cp)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	n := 0
+	for _, c := range tail {
+		if sim.StepNum == step && c.Op == OpStep {
+			break
+		}
+		if err := sim.Apply(c); err != nil {
+			return nil, nil, 0, fmt.Errorf("rewind: %s: %w", c.Op, err)
+		}
+		n++
+	}
+	if sim.StepNum != step {
+		return nil, nil, 0, fmt.Errorf("step %d is not reachable from the rewind point at %d", step, p.cp.Step)
+	}
+	cp, err := sim.Checkpoint()
+	return cp, p, n, err
+}
+
+// Rewind returns the simulation to an earlier step. Everything after it is
+// discarded; rewind points up to the step are kept so you can go back further.
+func (s *Simulation) Rewind(step int) error {
+	cp, p, n, err := s.stateAt(step)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.unlock()
+	i := -1
+	if s.tt != nil {
+		for j, q := range s.tt.points {
+			if q == p {
+				i = j
+			}
+		}
+	}
+	if i < 0 {
+		return fmt.Errorf("history was replaced while rewinding; try again")
+	}
+	install, err := s.prepareRestore(cp)
+	if err != nil {
+		return err
+	}
+	if err := s.journalOp(OpRestore, cp); err != nil {
+		return err
+	}
+	install()
+	s.tt.points = s.tt.points[:i+1]
+	p.tail = p.tail[:n]
+	if p.cp.Step != step {
+		s.tt.mark(s)
+	}
+	return nil
+}
+
+// --- forks ---
+
+// Fork copies the simulation at its current step. The copy has its own
+// clock, observers and rewind points, and no journal.
+func (s *Simulation) Fork() (*Simulation, error) {
+	cp, err := s.Checkpoint()
+	if err != nil {
+		return nil, err
+	}
+	return s.forkFrom(cp)
+}
+
+// ForkAt copies the simulation as it was at an earlier step.
+func (s *Simulation) ForkAt(step int) (*Simulation, error) {
+	cp, _, _, err := s.stateAt(step)
+	if err != nil {
+		return nil, err
+	}
+	return s.forkFrom(cp)
+}
+
+func (s *Simulation) forkFrom(cp *Checkpoint) (*Simulation, error) {
+	f, err := FromCheckpoint(cp)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	every, keep := 0, 0
+	if s.tt != nil {
+		every, keep = s.tt.every, s.tt.keep
+	}
+	s.mu.Unlock()
+	f.SetRewind(every, keep)
+	return f, nil
+}
+
+// --- diff ---
+
+// BranchSide summarises one branch of a diff.
+type BranchSide struct {
+	Step       int                 `json:"step"`
+	TotalError float64             `json:"total_error"`
+	MetaEnergy float64             `json:"meta_energy"`
+	Collapsed  bool                `json:"collapsed"`
+	Outcome    string              `json:"outcome"`
+	Params     Params              `json:"params"`
+	Receipts   map[ReceiptType]int `json:"receipts"` // since the fork step
+}
+
+// BubbleDelta compares one bubble across branches; a nil side means the bubble
+// does not exist there.
+type BubbleDelta struct {
+	ID string      `json:"id"`
+	A  *BubbleInfo `json:"a,omitempty"`
+	B  *BubbleInfo `json:"b,omitempty"`
+}
+
+// BranchDiff compares two simulations that share history up to Since.
+type BranchDiff struct {
+	Since   int           `json:"since"`
+	A       BranchSide    `json:"a"`
+	B       BranchSide    `json:"b"`
+	Bubbles []BubbleDelta `json:"bubbles"` // only bubbles that differ
+}
+
+// diffEpsilon hides floating-point noise in bubble comparisons.
+const diffEpsilon = 1e-9
+
+// Diff compares branches a and b, counting receipts after step since.
+func Diff(a, b *Simulation, since int) BranchDiff {
+	d := BranchDiff{Since: since, A: a.side(since), B: b.side(since), Bubbles: []BubbleDelta{}}
+	ab, bb := a.Bubbles(), b.Bubbles()
+	byID := map[string]*BubbleInfo{}
+	for i := range bb {
+		byID[bb[i].ID] = &bb[i]
+	}
+	for i := range ab {
+		x := &ab[i]
+		y := byID[x.ID]
+		delete(byID, x.ID)
+		if y == nil || !closeBubble(*x, *y) {
+			d.Bubbles = append(d.Bubbles, BubbleDelta{ID: x.ID, A: x, B: y})
+		}
+	}
+	for i := range bb {
+		if y := byID[bb[i].ID]; y != nil {
+			d.Bubbles = append(d.Bubbles, BubbleDelta{ID: y.ID, B: y})
+		}
+	}
+	return d
+}
+
+func (s *Simulation) side(since int) BranchSide {
+	s.mu.Lock()
+	st := s.state()
+	bs := BranchSide{Step: st.Step, TotalError: st.TotalError, MetaEnergy: st.MetaEnergy,
+		Collapsed: s.collapsed, Params: s.ParamsCfg, Receipts: map[ReceiptType]int{}}
+	for _, r := range s.Ledger.Since(s.Ledger.AfterStep(since)) {
+		bs.Receipts[r.Type]++
+	}
+	all := s.Ledger.All()
+	s.mu.Unlock()
+	bs.Outcome = Explain(all).Outcome
+	return bs
+}
+
+func closeBubble(a, b BubbleInfo) bool {
+	near := func(x, y float64) bool { return math.Abs(x-y) <= diffEpsilon }
+	return a.Parent == b.Parent && a.Child == b.Child &&
+		near(a.State, b.State) && near(a.Demand, b.Demand) && near(a.Tolerance, b.Tolerance) &&
+		near(a.Error, b.Error) && a.Culprit == b.Culprit && a.Resolved == b.Resolved
+}
@@ -0,0 +1,151 @@
+package tag
+
+import (
+	"reflect"
+	"testing"
+)
+
+// view is what a caller sees of a simulation, without ledger positions
+// (an in-place rewind keeps sequence numbers counting).
+type view struct {
+	Step       int
+	TotalError float64
+	MetaEnergy float64
+	Params     Params
+	Bubbles    []BubbleInfo
+}
+
+func viewOf(s *Simulation) view {
+	st := s.State()
+	return view{st.Step, st.TotalError, st.MetaEnergy, s.Params(), s.Bubbles()}
+}
+
+// timelineSim steps a rewindable simulation to step 40, changing a parameter
+// and a driver on the way, and returns what it looked like at step 17.
+func timelineSim(t *testing.T) (*Simulation, view) {
+	t.Helper()
+	sim := NewSimulation()
+	sim.SetRewind(10, 5)
+	var at17 view
+	viscosity := 0.2
+	for sim.State().Step < 40 {
+		switch sim.State().Step {
+		case 15:
+			if err := sim.SetParams(ParamsPatch{Viscosity: &viscosity}); err != nil {
+				t.Fatal(err)
+			}
+		case 16:
+			if err := sim.Attach("B", FieldDemand, Constant{V: 1.9}); err != nil {
+				t.Fatal(err)
+			}
+		case 17:
+			at17 = viewOf(sim)
+		}
+		sim.Step()
+	}
+	return sim, at17
+}
+
+func TestRewind(t *testing.T) {
+	sim, at17 := timelineSim(t)
+	if rr := sim.RewindRange(); rr.From != 0 || rr.To != 40 || !reflect.DeepEqual(rr.Points, []int{0, 10, 20, 30, 40}) {
+		t.Fatalf("rewind range %+v", rr)
+	}
+	for _, tc := range []struct {
+		name string
+		step int
+	}{{"future", 41}, {"before the oldest point", -1}} {
+		if err := sim.Rewind(tc.step); err == nil {
+			t.Errorf("rewind to a step %s: accepted", tc.name)
+		}
+	}
+
+	if err := sim.Rewind(17); err != nil {
+		t.Fatal(err)
+	}
+	if got := viewOf(sim); !reflect.DeepEqual(got, at17) {
+		t.Fatalf("rewound to\n%+v\nwas\n%+v", got, at17)
+	}
+	// points after the target are gone, and the target itself is one now
+	if rr := sim.RewindRange(); !reflect.DeepEqual(rr.Points, []int{0, 10, 17}) {
+		t.Fatalf("points after rewinding: %v", rr.Points)
+	}
+	if err := sim.Rewind(12); err != nil {
+		t.Fatalf("rewinding further back: %v", err)
+	}
+
+	sim.SetRewind(0, 0)
+	if err := sim.Rewind(5); err == nil {
+		t.Error("rewind with rewinding disabled: accepted")
+	}
+}
+
+func TestForkAt(t *testing.T) {
+	sim, at17 := timelineSim(t)
+	before := viewOf(sim)
+	f, err := sim.ForkAt(17)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := viewOf(f); !reflect.DeepEqual(got, at17) {
+		t.Fatalf("fork at 17 is\n%+v\nwas\n%+v", got, at17)
+	}
+	for i := 0; i < 5; i++ {
+		f.Step()
+	}
+	if got := viewOf(sim); !reflect.DeepEqual(got, before) {
+		t.Fatal("stepping the fork changed the original")
+	}
+	if rr := f.RewindRange(); len(rr.Points) == 0 || rr.Points[0] != 17 {
+		t.Fatalf("fork rewind points %v, want them to start at the fork", rr.Points)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := NewSimulation()
+	for i := 0; i < 10; i++ {
+		a.Step()
+	}
+	b, err := a.Fork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	same, _ := a.Fork()
+	for i := 0; i < 10; i++ {
+		a.Step()
+		same.Step()
+	}
+	if d := Diff(a, same, 10); len(d.Bubbles) != 0 || !reflect.DeepEqual(d.A, d.B) {
+		t.Fatalf("identical branches differ: %+v", d)
+	}
+
+	dt := 0.5
+	if err := b.SetParams(ParamsPatch{Dt: &dt}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Attach("B", FieldDemand, Constant{V: 3}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		b.Step()
+	}
+	d := Diff(a, b, 10)
+	if d.A.Step != 20 || d.B.Step != 15 {
+		t.Fatalf("steps %d and %d", d.A.Step, d.B.Step)
+	}
+	if d.A.Params.Dt == d.B.Params.Dt {
+		t.Error("changed dt not reported")
+	}
+	if d.A.Receipts[RDrive] != 0 || d.B.Receipts[RDrive] == 0 {
+		t.Errorf("drive receipts since the fork: %d and %d", d.A.Receipts[RDrive], d.B.Receipts[RDrive])
+	}
+	var sawB bool
+	for _, bd := range d.Bubbles {
+		if bd.ID == "B" {
+			sawB = bd.A != nil && bd.B != nil && bd.A.Demand != bd.B.Demand
+		}
+	}
+	if !sawB {
+		t.Errorf("bubble B's new demand not reported: %+v", d.Bubbles)
+	}
+}
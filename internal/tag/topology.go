@@ -0,0 +1,342 @@
+package tag
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ErrNotFound is returned when a bubble ID does not exist.
+var ErrNotFound = errors.New("not found")
+
+// HistoryLen is how many per-step samples are kept for each bubble.
+const HistoryLen = 256
+
+// BubbleInfo is the JSON view of one ToteBubble and its error mirror.
+type BubbleInfo struct {
+	ID        string   `json:"id"`
+	Parent    string   `json:"parent,omitempty"`
+	Child     string   `json:"child,omitempty"`
+	State     float64  `json:"state"`
+	Demand    float64  `json:"demand"`
+	Tolerance float64  `json:"tolerance"`
+	Error     float64  `json:"error"`
+	Culprit   bool     `json:"culprit,omitempty"`
+	Resolved  bool     `json:"resolved,omitempty"`
+	Drivers   []string `json:"drivers,omitempty"` // driven fields
+}
+
+// BubbleSpec describes a bubble to insert. After names the parent; empty means the tail.
+type BubbleSpec struct {
+	ID        string  `json:"id"`
+	After     string  `json:"after,omitempty"`
+	State     float64 `json:"state"`
+	Demand    float64 `json:"demand"`
+	Tolerance float64 `json:"tolerance"`
+}
+
+// BubblePatch sets any subset of a bubble's parameters.
+type BubblePatch struct {
+	State     *float64 `json:"state,omitempty"`
+	Demand    *float64 `json:"demand,omitempty"`
+	Tolerance *float64 `json:"tolerance,omitempty"`
+}
+
+// BubbleSample is one entry of a bubble's history.
+type BubbleSample struct {
+	Step   int     `json:"step"`
+	State  float64 `json:"state"`
+	Demand float64 `json:"demand"`
+	Error  float64 `json:"error"`
+}
+
+// --- inspection ---
+
+// Bubbles lists the chain from the root down.
+func (s *Simulation) Bubbles() []BubbleInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []BubbleInfo
+	for t := s.Root; t != nil; t = t.Child {
+		out = append(out, s.info(t))
+	}
+	return out
+}
+
+// Bubble returns one bubble by ID.
+func (s *Simulation) Bubble(id string) (BubbleInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := findBubble(s.Root, id)
+	if t == nil {
+		return BubbleInfo{}, fmt.Errorf("bubble %q: %w", id, ErrNotFound)
+	}
+	return s.info(t), nil
+}
+
+// History returns the recorded per-step samples of a bubble, oldest first.
+func (s *Simulation) History(id string) ([]BubbleSample, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if findBubble(s.Root, id) == nil {
+		return nil, fmt.Errorf("bubble %q: %w", id, ErrNotFound)
+	}
+	return append([]BubbleSample(nil), s.history[id]...), nil
+}
+
+func (s *Simulation) info(t *ToteBubble) BubbleInfo {
+	bi := BubbleInfo{ID: t.ID, State: t.State, Demand: t.Demand, Tolerance: t.Tolerance}
+	if t.Parent != nil {
+		bi.Parent = t.Parent.ID
+	}
+	if t.Child != nil {
+		bi.Child = t.Child.ID
+	}
+	if e := s.errorOf(t); e != nil {
+		bi.Error, bi.Culprit, bi.Resolved = e.ErrorValue, e.IsCulprit, e.Resolved
+	}
+	for _, b := range s.Drivers {
+		if b.Bubble == t.ID {
+			bi.Drivers = append(bi.Drivers, string(b.Field))
+		}
+	}
+	return bi
+}
+
+func (s *Simulation) errorOf(t *ToteBubble) *ErrorBubble {
+	for e := s.ErrRoot; e != nil; e = e.Downstream {
+		if e.Origin == t {
+			return e
+		}
+	}
+	return nil
+}
+
+// recordHistory samples every bubble at the end of a step; callers hold s.mu.
+func (s *Simulation) recordHistory(step int) {
+	for t := s.Root; t != nil; t = t.Child {
+		sample := BubbleSample{Step: step, State: t.State, Demand: t.Demand}
+		if e := s.errorOf(t); e != nil {
+			sample.Error = e.ErrorValue
+		}
+		h := append(s.history[t.ID], sample)
+		if len(h) > HistoryLen {
+			h = h[len(h)-HistoryLen:]
+		}
+		s.history[t.ID] = h
+	}
+}
+
+// --- editing ---
+
+// AddBubble inserts a new bubble after spec.After (or at the tail).
+func (s *Simulation) AddBubble(spec BubbleSpec) error {
+	s.mu.Lock()
+	defer s.unlock()
+	if err := validID(spec.ID); err != nil {
+		return err
+	}
+	if findBubble(s.Root, spec.ID) != nil {
+		return fmt.Errorf("bubble %q already exists", spec.ID)
+	}
+	if err := validValues(&spec.State, &spec.Demand, &spec.Tolerance); err != nil {
+		return err
+	}
+	parent, err := s.parentFor(spec.After)
+	if err != nil {
+		return err
+	}
+	if err := s.journalOp(OpAddBubble, spec); err != nil {
+		return err
+	}
+	t := &ToteBubble{ID: spec.ID, State: spec.State, Demand: spec.Demand, Tolerance: spec.Tolerance}
+	insertAfter(parent, t)
+	s.rebuildErrorChain()
+	s.collapsed = false
+	s.commit(Receipt{
+		Step: s.StepNum, Type: RTopology, Subject: t.ID,
+		Note: "bubble added after " + parent.ID,
+	})
+	return nil
+}
+
+// RemoveBubble unlinks a bubble; its child takes its place. The root cannot be removed.
+func (s *Simulation) RemoveBubble(id string) error {
+	s.mu.Lock()
+	defer s.unlock()
+	t := findBubble(s.Root, id)
+	if t == nil {
+		return fmt.Errorf("bubble %q: %w", id, ErrNotFound)
+	}
+	if t == s.Root {
+		return fmt.Errorf("cannot remove root bubble %q", id)
+	}
+	if err := s.journalOp(OpRemoveBubble, idArgs{ID: id}); err != nil {
+		return err
+	}
+	unlink(t)
+	s.detach(id, FieldState)
+	s.detach(id, FieldDemand)
+	delete(s.tracks, id)
+	delete(s.history, id)
+	s.rebuildErrorChain()
+	s.collapsed = false
+	s.commit(Receipt{
+		Step: s.StepNum, Type: RTopology, Subject: id,
+		Note: "bubble removed",
+	})
+	return nil
+}
+
+// Relink moves a bubble so that it follows after.
+func (s *Simulation) Relink(id, after string) error {
+	s.mu.Lock()
+	defer s.unlock()
+	t := findBubble(s.Root, id)
+	if t == nil {
+		return fmt.Errorf("bubble %q: %w", id, ErrNotFound)
+	}
+	if t == s.Root {
+		return fmt.Errorf("cannot relink root bubble %q", id)
+	}
+	if id == after {
+		return fmt.Errorf("bubble %q cannot follow itself", id)
+	}
+	parent, err := s.parentFor(after)
+	if err != nil {
+		return err
+	}
+	if err := s.journalOp(OpRelink, idArgs{ID: id, After: after}); err != nil {
+		return err
+	}
+	from := t.Parent.ID
+	unlink(t)
+	insertAfter(parent, t)
+	s.rebuildErrorChain()
+	s.collapsed = false
+	s.commit(Receipt{
+		Step: s.StepNum, Type: RTopology, Subject: id,
+		Note: "bubble relinked from " + from + " to " + parent.ID,
+	})
+	return nil
+}
+
+// SetBubble applies a parameter patch, recording one receipt per changed field.
+func (s *Simulation) SetBubble(id string, p BubblePatch) error {
+	s.mu.Lock()
+	defer s.unlock()
+	t := findBubble(s.Root, id)
+	if t == nil {
+		return fmt.Errorf("bubble %q: %w", id, ErrNotFound)
+	}
+	if err := validValues(p.State, p.Demand, p.Tolerance); err != nil {
+		return err
+	}
+	if err := s.journalOp(OpSetBubble, idArgs{ID: id, Patch: &p}); err != nil {
+		return err
+	}
+	s.collapsed = false
+	for _, c := range []struct {
+		name string
+		dst  *float64
+		v    *float64
+	}{{"state", &t.State, p.State}, {"demand", &t.Demand, p.Demand}, {"tolerance", &t.Tolerance, p.Tolerance}} {
+		if c.v == nil {
+			continue
+		}
+		before := *c.dst
+		*c.dst = *c.v
+		s.commit(Receipt{
+			Step: s.StepNum, Type: RSet, Subject: id,
+			Note: "set " + c.name, Payload: change(c.name, before, *c.v),
+		})
+	}
+	return nil
+}
+
+// --- helpers ---
+
+func validID(id string) error {
+	if id == "" || strings.TrimSpace(id) != id || strings.ContainsAny(id, " /") {
+		return fmt.Errorf("invalid bubble id %q", id)
+	}
+	return nil
+}
+
+// validValues rejects non-finite numbers and negative tolerances; nil entries are skipped.
+func validValues(state, demand, tolerance *float64) error {
+	for _, c := range []struct {
+		name string
+		v    *float64
+	}{{"state", state}, {"demand", demand}, {"tolerance", tolerance}} {
+		if c.v != nil && (math.IsNaN(*c.v) || math.IsInf(*c.v, 0)) {
+			return fmt.Errorf("%s must be finite", c.name)
+		}
+	}
+	if tolerance != nil && *tolerance < 0 {
+		return fmt.Errorf("tolerance must be >= 0")
+	}
+	return nil
+}
+
+func (s *Simulation) parentFor(after string) (*ToteBubble, error) {
+	if after == "" {
+		t := s.Root
+		for t.Child != nil {
+			t = t.Child
+		}
+		return t, nil
+	}
+	p := findBubble(s.Root, after)
+	if p == nil {
+		return nil, fmt.Errorf("bubble %q: %w", after, ErrNotFound)
+	}
+	return p, nil
+}
+
+func insertAfter(parent, t *ToteBubble) {
+	t.Parent, t.Child = parent, parent.Child
+	if parent.Child != nil {
+		parent.Child.Parent = t
+	}
+	parent.Child = t
+}
+
+func unlink(t *ToteBubble) {
+	if t.Parent != nil {
+		t.Parent.Child = t.Child
+	}
+	if t.Child != nil {
+		t.Child.Parent = t.Parent
+	}
+	t.Parent, t.Child = nil, nil
+}
+
+// rebuildErrorChain mirrors the chain below the root again, reusing
+// existing error bubbles so their values and flags survive the edit. Errors
+// left behind keep no links, so checkpoints still see mirrored lists.
+func (s *Simulation) rebuildErrorChain() {
+	old := map[*ToteBubble]*ErrorBubble{}
+	for e := s.ErrRoot; e != nil; e = e.Downstream {
+		old[e.Origin] = e
+	}
+	for _, e := range old {
+		e.Upstream, e.Downstream = nil, nil
+	}
+	s.ErrRoot = nil
+	var prev *ErrorBubble
+	for t := s.Root.Child; t != nil; t = t.Child {
+		e := old[t]
+		if e == nil {
+			e = &ErrorBubble{ID: t.ID + ".err", Origin: t}
+		}
+		e.Upstream, e.Downstream = prev, nil
+		if prev == nil {
+			s.ErrRoot = e
+		} else {
+			prev.Downstream = e
+		}
+		prev = e
+	}
+}
@@ -7,17 +7,27 @@ type Params struct {
 	Dt        float64 `json:"dt"`
 }
 
+// SchemaVersion is stamped on SimState and Frame; it changes whenever a
+// field is renamed, removed or changes meaning.
+const SchemaVersion = 1
+
 // SimState is a JSON snapshot returned by /api/tag/state and /api/tag/step.
 type SimState struct {
+	Schema     int       `json:"schema"`
 	Step       int       `json:"step"`
 	TotalError float64   `json:"total_error"`
 	MetaEnergy float64   `json:"meta_energy"`
 	Receipts   []Receipt `json:"receipts,omitempty"`
+	// JournalError is set once a journal write has failed; from then on
+	// every change is refused.
+	JournalError string `json:"journal_error,omitempty"`
 }
 
 // internal/tag/types.go
 type Bubble struct {
+	ID        string     `json:"id"`         // node the bubble belongs to
 	Label     string     `json:"label"`      // "A.tote", "A.err", "B.tote", "B.err"
+	Kind      string     `json:"kind"`       // "tote", "error" or "meta"
 	Center    [2]float64 `json:"center"`     // normalized [-1,1] space
 	Radius    float64    `json:"radius"`     // scaled magnitude for drawing
 	Excess    float64    `json:"excess"`     // functional excess parked in error bubble
@@ -26,14 +36,10 @@ type Bubble struct {
 }
 
 type Frame struct {
-	Step       int `json:"step"`
-	Equilibria struct {
-		A bool `json:"A"`
-		B bool `json:"B"`
-		C bool `json:"C"`
-		D bool `json:"D"`
-	} `json:"equilibria"`
-	Bubbles    []Bubble `json:"bubbles"`      // four entries: A.tote, A.err, B.tote, B.err
-	ErrScalarA float64  `json:"err_scalar_a"` // recent error metric
-	ErrScalarB float64  `json:"err_scalar_b"`
+	Schema     int                `json:"schema"`
+	Step       int                `json:"step"`
+	Equilibria map[string]bool    `json:"equilibria"`  // node ID -> within tolerance
+	Bubbles    []Bubble           `json:"bubbles"`     // a tote and an error bubble per node, then meta
+	Links      [][2]string        `json:"links"`       // bubble labels to connect
+	ErrScalars map[string]float64 `json:"err_scalars"` // node ID -> current error value
 }
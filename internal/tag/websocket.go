@@ -0,0 +1,345 @@
+package tag
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// The server half of RFC 6455, enough for JSON-RPC over text messages:
+// no extensions, no subprotocols.
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Frame opcodes.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// Close status codes.
+const (
+	wsCloseNormal      = 1000
+	wsCloseGoingAway   = 1001
+	wsCloseProtocol    = 1002
+	wsCloseUnsupported = 1003
+	wsCloseInvalidData = 1007
+	wsCloseTooBig      = 1009
+)
+
+// WSOrigins lists the browser origins ("https://dash.example", or "*" for
+// any) that may open WebSockets besides the server's own. Browsers send
+// cookies and other ambient credentials with cross-site handshakes, so
+// other pages are refused unless listed. Clients that send no Origin are
+// not browsers and are let through.
+var WSOrigins []string
+
+// originAllowed applies WSOrigins to a handshake.
+func originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, o := range WSOrigins {
+		if o == "*" || strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// validCloseCode reports whether a client may send code in a close frame:
+// the defined codes that are not reserved for local use, or an
+// application code.
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	}
+	return code >= 3000 && code <= 4999
+}
+
+const (
+	wsPingEvery = 30 * time.Second // keepalive ping interval
+	wsPongWait  = 60 * time.Second // a silent client is dropped after this
+	wsWriteWait = 10 * time.Second // a client that stops reading is dropped after this
+)
+
+// wsError closes the connection with a status code.
+type wsError struct {
+	code   int
+	reason string
+}
+
+func (e *wsError) Error() string { return fmt.Sprintf("websocket: %s (%d)", e.reason, e.code) }
+
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	wmu  sync.Mutex
+	msg  []byte // message being reassembled from fragments
+}
+
+// headerHas reports whether a comma-separated header lists token.
+func headerHas(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeWS completes the opening handshake and takes over the connection.
+// On failure it has already answered with an error.
+func upgradeWS(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	bad := func(status int, msg string) (*wsConn, error) {
+		err := &APIError{Status: status, Code: CodeBadRequest, Message: msg}
+		writeError(w, err)
+		return nil, err
+	}
+	if !headerHas(r.Header, "Connection", "upgrade") || !headerHas(r.Header, "Upgrade", "websocket") {
+		return bad(http.StatusBadRequest, "not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return bad(http.StatusUpgradeRequired, "websocket version 13 required")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if k, err := base64.StdEncoding.DecodeString(key); err != nil || len(k) != 16 {
+		return bad(http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	}
+	if !originAllowed(r) {
+		err := &APIError{Status: http.StatusForbidden, Code: CodeForbidden, Message: "websocket origin not allowed"}
+		writeError(w, err)
+		return nil, err
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return bad(http.StatusInternalServerError, "websocket unsupported")
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum([]byte(key + wsGUID))
+	fmt.Fprintf(brw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return &wsConn{conn: conn, br: brw.Reader}, nil
+}
+
+// readMessage returns the next text message, answering pings and skipping
+// pongs on the way. A close from the client is echoed and reported as
+// io.EOF; a malformed one is answered with a protocol error.
+func (c *wsConn) readMessage() ([]byte, error) {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			if err := checkClose(payload); err != nil {
+				return nil, err
+			}
+			c.writeFrame(wsClose, payload[:min(len(payload), 2)])
+			return nil, io.EOF
+		case wsText:
+			if c.msg != nil {
+				return nil, &wsError{wsCloseProtocol, "new message inside a fragmented one"}
+			}
+			c.msg = payload
+		case wsBinary:
+			return nil, &wsError{wsCloseUnsupported, "binary messages not supported"}
+		case wsContinuation:
+			if c.msg == nil {
+				return nil, &wsError{wsCloseProtocol, "continuation without a message"}
+			}
+			if len(c.msg)+len(payload) > maxRPCBody {
+				return nil, &wsError{wsCloseTooBig, "message too big"}
+			}
+			c.msg = append(c.msg, payload...)
+		default:
+			return nil, &wsError{wsCloseProtocol, fmt.Sprintf("unknown opcode %d", op)}
+		}
+		if fin {
+			msg := c.msg
+			c.msg = nil
+			if !utf8.Valid(msg) {
+				return nil, &wsError{wsCloseInvalidData, "text message is not valid UTF-8"}
+			}
+			return msg, nil
+		}
+	}
+}
+
+// checkClose validates a close frame's body: empty, or a status code a
+// client may send followed by a UTF-8 reason.
+func checkClose(payload []byte) error {
+	switch {
+	case len(payload) == 0:
+		return nil
+	case len(payload) == 1:
+		return &wsError{wsCloseProtocol, "close frame with a truncated status code"}
+	case !validCloseCode(int(binary.BigEndian.Uint16(payload))):
+		return &wsError{wsCloseProtocol, fmt.Sprintf("invalid close code %d", binary.BigEndian.Uint16(payload))}
+	case !utf8.Valid(payload[2:]):
+		return &wsError{wsCloseInvalidData, "close reason is not valid UTF-8"}
+	}
+	return nil
+}
+
+func (c *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var h [2]byte
+	if _, err = io.ReadFull(c.br, h[:]); err != nil {
+		return
+	}
+	fin, op = h[0]&0x80 != 0, h[0]&0x0f
+	if h[0]&0x70 != 0 {
+		return fin, op, nil, &wsError{wsCloseProtocol, "reserved bits set"}
+	}
+	if h[1]&0x80 == 0 {
+		return fin, op, nil, &wsError{wsCloseProtocol, "client frames must be masked"}
+	}
+	n := uint64(h[1] & 0x7f)
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err = io.ReadFull(c.br, b[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err = io.ReadFull(c.br, b[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(b[:])
+	}
+	if op >= wsClose && (n > 125 || !fin) {
+		return fin, op, nil, &wsError{wsCloseProtocol, "invalid control frame"}
+	}
+	if n > maxRPCBody {
+		return fin, op, nil, &wsError{wsCloseTooBig, "message too big"}
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// writeFrame sends one unfragmented frame. Writes that stall for wsWriteWait
+// fail, so a client that stops reading cannot hold events back forever.
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	hdr := make([]byte, 2, 10)
+	hdr[0] = 0x80 | op
+	switch n := len(payload); {
+	case n <= 125:
+		hdr[1] = byte(n)
+	case n <= 0xffff:
+		hdr[1] = 126
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	default:
+		hdr[1] = 127
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	_, err := (&net.Buffers{hdr, payload}).WriteTo(c.conn)
+	return err
+}
+
+// close sends a close frame, best effort, and drops the connection.
+func (c *wsConn) close(code int, reason string) {
+	b := binary.BigEndian.AppendUint16(nil, uint16(code))
+	c.writeFrame(wsClose, append(b, reason...))
+	c.conn.Close()
+}
+
+// ServeWebSocket upgrades the request and serves JSON-RPC 2.0 over it, one
+// message per text frame; subscriptions push "event" notifications. The
+// server pings every wsPingEvery and drops clients silent for wsPongWait.
+func (s *RPC) ServeWebSocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgradeWS(w, r)
+	if err != nil {
+		return
+	}
+	// a server shutting down cancels the request context; say goodbye
+	stop := context.AfterFunc(r.Context(), func() { ws.close(wsCloseGoingAway, "server going away") })
+	defer stop()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		t := time.NewTicker(wsPingEvery)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if ws.writeFrame(wsPing, nil) != nil {
+					ws.conn.Close() // unblocks the reader
+					return
+				}
+			}
+		}
+	}()
+
+	write := func(b []byte) error {
+		err := ws.writeFrame(wsText, b)
+		if err != nil {
+			ws.conn.Close()
+		}
+		return err
+	}
+	err = s.serve(r.Context(), ws.readMessage, write)
+	var we *wsError
+	if errors.As(err, &we) {
+		ws.close(we.code, we.reason)
+		return
+	}
+	ws.close(wsCloseNormal, "")
+}
@@ -0,0 +1,230 @@
+package tag
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const wsTestKey = "dGhlIHNhbXBsZSBub25jZQ=="
+
+func wsServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, NewSimulation())
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// wsHandshake sends an opening handshake with the given extra headers and
+// returns the connection and the response status.
+func wsHandshake(t *testing.T, srv *httptest.Server, headers map[string]string) (net.Conn, *bufio.Reader, int) {
+	t.Helper()
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	h := map[string]string{
+		"Host":                  srv.Listener.Addr().String(),
+		"Connection":            "keep-alive, Upgrade",
+		"Upgrade":               "websocket",
+		"Sec-WebSocket-Version": "13",
+		"Sec-WebSocket-Key":     wsTestKey,
+	}
+	for k, v := range headers {
+		h[k] = v
+	}
+	req := "GET /api/tag/ws HTTP/1.1\r\n"
+	for k, v := range h {
+		if v != "" {
+			req += k + ": " + v + "\r\n"
+		}
+	}
+	io.WriteString(conn, req+"\r\n")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+			t.Fatalf("Sec-WebSocket-Accept %q", got)
+		}
+	}
+	return conn, br, resp.StatusCode
+}
+
+func wsDial(t *testing.T, srv *httptest.Server) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, br, status := wsHandshake(t, srv, nil)
+	if status != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake: %d", status)
+	}
+	return conn, br
+}
+
+// wsSend writes one masked client frame.
+func wsSend(t *testing.T, conn net.Conn, fin bool, op byte, payload []byte) {
+	t.Helper()
+	b0 := op
+	if fin {
+		b0 |= 0x80
+	}
+	hdr := []byte{b0, 0x80}
+	switch n := len(payload); {
+	case n <= 125:
+		hdr[1] |= byte(n)
+	default:
+		hdr[1] |= 126
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	}
+	mask := []byte{1, 2, 3, 4}
+	masked := make([]byte, len(payload))
+	for i, c := range payload {
+		masked[i] = c ^ mask[i%4]
+	}
+	if _, err := conn.Write(append(append(hdr, mask...), masked...)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// wsRecv reads one unmasked server frame.
+func wsRecv(t *testing.T, br *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var h [2]byte
+	if _, err := io.ReadFull(br, h[:]); err != nil {
+		t.Fatal(err)
+	}
+	n := int(h[1] & 0x7f)
+	switch n {
+	case 126:
+		var b [2]byte
+		io.ReadFull(br, b[:])
+		n = int(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		io.ReadFull(br, b[:])
+		n = int(binary.BigEndian.Uint64(b[:]))
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		t.Fatal(err)
+	}
+	return h[0] & 0x0f, payload
+}
+
+// wsExpectClose reads until the server's close frame and checks its code.
+func wsExpectClose(t *testing.T, br *bufio.Reader, code int) {
+	t.Helper()
+	for {
+		op, payload := wsRecv(t, br)
+		if op != wsClose {
+			continue
+		}
+		if len(payload) < 2 || int(binary.BigEndian.Uint16(payload)) != code {
+			t.Fatalf("closed with %q, want code %d", payload, code)
+		}
+		return
+	}
+}
+
+func TestWSHandshake(t *testing.T) {
+	srv := wsServer(t)
+	defer func(old []string) { WSOrigins = old }(WSOrigins)
+	WSOrigins = []string{"https://dash.example"}
+	self := "http://" + srv.Listener.Addr().String()
+	for _, tc := range []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"plain client", nil, http.StatusSwitchingProtocols},
+		{"same origin", map[string]string{"Origin": self}, http.StatusSwitchingProtocols},
+		{"listed origin", map[string]string{"Origin": "https://dash.example"}, http.StatusSwitchingProtocols},
+		{"foreign origin", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"opaque origin", map[string]string{"Origin": "null"}, http.StatusForbidden},
+		{"no upgrade", map[string]string{"Upgrade": ""}, http.StatusBadRequest},
+		{"old version", map[string]string{"Sec-WebSocket-Version": "8"}, http.StatusUpgradeRequired},
+		{"short key", map[string]string{"Sec-WebSocket-Key": "c2hvcnQ="}, http.StatusBadRequest},
+	} {
+		if _, _, got := wsHandshake(t, srv, tc.headers); got != tc.want {
+			t.Errorf("%s: %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestWSFragmentedMessage(t *testing.T) {
+	conn, br := wsDial(t, wsServer(t))
+	msg := []byte(`{"jsonrpc": "2.0", "id": 7, "method": "params.get"}`)
+	wsSend(t, conn, false, wsText, msg[:10])
+	wsSend(t, conn, true, wsPing, []byte("mid")) // control frames may interleave
+	wsSend(t, conn, false, wsContinuation, msg[10:30])
+	wsSend(t, conn, true, wsContinuation, msg[30:])
+
+	if op, payload := wsRecv(t, br); op != wsPong || string(payload) != "mid" {
+		t.Fatalf("got opcode %d %q, want the pong", op, payload)
+	}
+	op, payload := wsRecv(t, br)
+	var resp RPCResponse
+	if op != wsText || json.Unmarshal(payload, &resp) != nil || resp.Error != nil || string(resp.ID) != "7" {
+		t.Fatalf("got opcode %d %s", op, payload)
+	}
+}
+
+func TestWSPingPong(t *testing.T) {
+	conn, br := wsDial(t, wsServer(t))
+	wsSend(t, conn, true, wsPing, []byte("are you there"))
+	if op, payload := wsRecv(t, br); op != wsPong || string(payload) != "are you there" {
+		t.Fatalf("got opcode %d %q", op, payload)
+	}
+	wsSend(t, conn, true, wsPong, nil) // unsolicited pongs are ignored
+	wsSend(t, conn, true, wsClose, binary.BigEndian.AppendUint16(nil, wsCloseNormal))
+	wsExpectClose(t, br, wsCloseNormal)
+}
+
+func TestWSRejectsBadFrames(t *testing.T) {
+	closeBody := func(code int, reason string) []byte {
+		return append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...)
+	}
+	for _, tc := range []struct {
+		name string
+		send func(*testing.T, net.Conn)
+		code int
+	}{
+		{"oversized frame", func(t *testing.T, c net.Conn) {
+			hdr := binary.BigEndian.AppendUint64([]byte{0x81, 0x80 | 127}, maxRPCBody+1)
+			c.Write(hdr)
+		}, wsCloseTooBig},
+		{"invalid UTF-8", func(t *testing.T, c net.Conn) { wsSend(t, c, true, wsText, []byte("{\"a\": \"\xff\"}")) }, wsCloseInvalidData},
+		{"UTF-8 split across fragments", func(t *testing.T, c net.Conn) {
+			wsSend(t, c, false, wsText, []byte("\xe2\x82"))
+			wsSend(t, c, true, wsContinuation, []byte("\xac")) // "€" whole again: fine
+			wsSend(t, c, true, wsText, []byte("\xe2\x82"))     // truncated: not fine
+		}, wsCloseInvalidData},
+		{"unmasked frame", func(t *testing.T, c net.Conn) { c.Write([]byte{0x81, 0x00}) }, wsCloseProtocol},
+		{"binary message", func(t *testing.T, c net.Conn) { wsSend(t, c, true, wsBinary, []byte{1}) }, wsCloseUnsupported},
+		{"fragmented ping", func(t *testing.T, c net.Conn) { wsSend(t, c, false, wsPing, nil) }, wsCloseProtocol},
+		{"stray continuation", func(t *testing.T, c net.Conn) { wsSend(t, c, true, wsContinuation, []byte("x")) }, wsCloseProtocol},
+		{"one-byte close", func(t *testing.T, c net.Conn) { wsSend(t, c, true, wsClose, []byte{3}) }, wsCloseProtocol},
+		{"reserved close code", func(t *testing.T, c net.Conn) { wsSend(t, c, true, wsClose, closeBody(1005, "")) }, wsCloseProtocol},
+		{"unassigned close code", func(t *testing.T, c net.Conn) { wsSend(t, c, true, wsClose, closeBody(2000, "")) }, wsCloseProtocol},
+		{"bad close reason", func(t *testing.T, c net.Conn) { wsSend(t, c, true, wsClose, closeBody(1000, "\xff")) }, wsCloseInvalidData},
+		{"application close code", func(t *testing.T, c net.Conn) { wsSend(t, c, true, wsClose, closeBody(4000, "done")) }, 4000},
+	} {
+		t.Run(strings.ReplaceAll(tc.name, " ", "_"), func(t *testing.T) {
+			conn, br := wsDial(t, wsServer(t))
+			tc.send(t, conn)
+			wsExpectClose(t, br, tc.code)
+		})
+	}
+}
@@ -0,0 +1,326 @@
+// Package tag is the public Go API of TAG, including a typed Client for tagd.
+package tag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/RickF71/tag-go/internal/tag"
+)
+
+// Client talks to a tagd server over /api/v1. Errors the server answers
+// with come back as *APIError.
+type Client struct {
+	base string // ".../api/v1"
+	sim  string // "/sims/{id}" for a hosted simulation, "" for the main one
+	// HTTP is used for every request; nil means http.DefaultClient. Leave its
+	// Timeout at zero if you Subscribe and bound calls with contexts instead.
+	HTTP *http.Client
+	// Token is sent as a bearer token when tagd runs with -auth.
+	Token string
+}
+
+// NewClient returns a client for the tagd at baseURL, e.g. "http://localhost:8080".
+func NewClient(baseURL string) *Client {
+	return &Client{base: strings.TrimRight(baseURL, "/") + "/api/v1"}
+}
+
+// Sim returns a client for the hosted simulation id; its simulation calls go
+// to /api/v1/sims/{id}/… instead of the main simulation.
+func (c *Client) Sim(id string) *Client {
+	return &Client{base: c.base, sim: "/sims/" + url.PathEscape(id), HTTP: c.HTTP, Token: c.Token}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTP != nil {
+		return c.HTTP
+	}
+	return http.DefaultClient
+}
+
+// send makes a request and returns the response of a 2xx answer; anything
+// else is decoded into an *APIError and the body closed.
+func (c *Client) send(ctx context.Context, method, path string, q url.Values, body io.Reader, header http.Header) (*http.Response, error) {
+	u := c.base + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	var env tag.ErrorEnvelope
+	if json.NewDecoder(resp.Body).Decode(&env) != nil || env.Error == nil {
+		return nil, &APIError{Status: resp.StatusCode, Code: tag.CodeInternal, Message: method + " " + path + ": " + resp.Status}
+	}
+	return nil, env.Error
+}
+
+// do sends in as JSON (unless nil) and decodes the answer into out (unless nil).
+func (c *Client) do(ctx context.Context, method, path string, q url.Values, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	resp, err := c.send(ctx, method, path, q, body, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%s %s: decode: %w", method, path, err)
+	}
+	return nil
+}
+
+// IsNotFound reports whether err is the server saying the target does not exist.
+func IsNotFound(err error) bool {
+	var ae *APIError
+	return errors.As(err, &ae) && ae.Status == http.StatusNotFound
+}
+
+// --- simulation ---
+
+func (c *Client) State(ctx context.Context) (SimState, error) {
+	var st SimState
+	return st, c.do(ctx, http.MethodGet, c.sim+"/state", nil, nil, &st)
+}
+
+func (c *Client) Frame(ctx context.Context) (Frame, error) {
+	var f Frame
+	return f, c.do(ctx, http.MethodGet, c.sim+"/frame", nil, nil, &f)
+}
+
+// Step advances one step and returns the new state.
+func (c *Client) Step(ctx context.Context) (SimState, error) {
+	var st SimState
+	return st, c.do(ctx, http.MethodPost, c.sim+"/step", nil, nil, &st)
+}
+
+// Run steps until the request's conditions or step limit are met.
+func (c *Client) Run(ctx context.Context, req RunRequest) (RunSummary, error) {
+	var sum RunSummary
+	return sum, c.do(ctx, http.MethodPost, c.sim+"/run", nil, req, &sum)
+}
+
+func (c *Client) Reset(ctx context.Context) (SimState, error) {
+	var st SimState
+	return st, c.do(ctx, http.MethodPost, c.sim+"/reset", nil, nil, &st)
+}
+
+func (c *Client) Params(ctx context.Context) (Params, error) {
+	var p Params
+	return p, c.do(ctx, http.MethodGet, c.sim+"/params", nil, nil, &p)
+}
+
+// SetParams changes the fields set in p and returns the resulting parameters.
+func (c *Client) SetParams(ctx context.Context, p ParamsPatch) (Params, error) {
+	var out Params
+	return out, c.do(ctx, http.MethodPatch, c.sim+"/params", nil, p, &out)
+}
+
+// Ingest posts observations and returns how many were accepted.
+func (c *Client) Ingest(ctx context.Context, obs ...Observation) (int, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf) // one object per line
+	for _, o := range obs {
+		if err := enc.Encode(o); err != nil {
+			return 0, err
+		}
+	}
+	h := http.Header{"Content-Type": {"application/x-ndjson"}}
+	resp, err := c.send(ctx, http.MethodPost, c.sim+"/ingest", nil, &buf, h)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	var res tag.IngestResult
+	return res.Accepted, json.NewDecoder(resp.Body).Decode(&res)
+}
+
+// --- receipts ---
+
+// ReceiptQuery selects a page of receipts; zero fields do not filter.
+type ReceiptQuery struct {
+	FromStep int
+	ToStep   int // inclusive; 0 means no upper bound
+	Types    []ReceiptType
+	Subjects []string
+	Text     string // case-insensitive substring of Note
+	Cursor   uint64 // a previous Page's Next
+	Limit    int
+}
+
+func (q ReceiptQuery) values() url.Values {
+	v := url.Values{}
+	for name, n := range map[string]int{"from_step": q.FromStep, "to_step": q.ToStep, "limit": q.Limit} {
+		if n > 0 {
+			v.Set(name, strconv.Itoa(n))
+		}
+	}
+	if len(q.Types) > 0 {
+		ts := make([]string, len(q.Types))
+		for i, t := range q.Types {
+			ts[i] = string(t)
+		}
+		v.Set("types", strings.Join(ts, ","))
+	}
+	if len(q.Subjects) > 0 {
+		v.Set("subject", strings.Join(q.Subjects, ","))
+	}
+	if q.Text != "" {
+		v.Set("q", q.Text)
+	}
+	if q.Cursor > 0 {
+		v.Set("cursor", strconv.FormatUint(q.Cursor, 10))
+	}
+	return v
+}
+
+// Receipts returns one page; pass its Next as the following query's Cursor.
+func (c *Client) Receipts(ctx context.Context, q ReceiptQuery) (Page, error) {
+	var p Page
+	return p, c.do(ctx, http.MethodGet, c.sim+"/receipts", q.values(), nil, &p)
+}
+
+// ExportReceipts returns every retained receipt and, when hash chaining is or
+// was on, the chain head to check them against.
+func (c *Client) ExportReceipts(ctx context.Context) ([]Receipt, string, error) {
+	resp, err := c.send(ctx, http.MethodGet, c.sim+"/receipts/export", nil, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	var rs []Receipt
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var r Receipt
+		if err := dec.Decode(&r); err == io.EOF {
+			break
+		} else if err != nil {
+			return rs, "", err
+		}
+		rs = append(rs, r)
+	}
+	return rs, resp.Header.Get("X-Tag-Chain-Head"), nil
+}
+
+// --- checkpoints ---
+
+// Checkpoint snapshots the whole simulation.
+func (c *Client) Checkpoint(ctx context.Context) (*Checkpoint, error) {
+	resp, err := c.send(ctx, http.MethodGet, c.sim+"/checkpoint", nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return tag.ReadCheckpoint(resp.Body)
+}
+
+// Restore replaces the simulation with cp and returns the restored state.
+func (c *Client) Restore(ctx context.Context, cp *Checkpoint) (SimState, error) {
+	var st SimState
+	return st, c.do(ctx, http.MethodPost, c.sim+"/checkpoint", nil, cp, &st)
+}
+
+// --- topology ---
+
+func (c *Client) Bubbles(ctx context.Context) ([]BubbleInfo, error) {
+	var bs []BubbleInfo
+	return bs, c.do(ctx, http.MethodGet, c.sim+"/bubbles", nil, nil, &bs)
+}
+
+func (c *Client) Bubble(ctx context.Context, id string) (BubbleInfo, error) {
+	var b BubbleInfo
+	return b, c.do(ctx, http.MethodGet, c.sim+"/bubbles/"+url.PathEscape(id), nil, nil, &b)
+}
+
+func (c *Client) AddBubble(ctx context.Context, spec BubbleSpec) (BubbleInfo, error) {
+	var b BubbleInfo
+	return b, c.do(ctx, http.MethodPost, c.sim+"/bubbles", nil, spec, &b)
+}
+
+func (c *Client) UpdateBubble(ctx context.Context, id string, p BubblePatch) (BubbleInfo, error) {
+	var b BubbleInfo
+	return b, c.do(ctx, http.MethodPatch, c.sim+"/bubbles/"+url.PathEscape(id), nil, p, &b)
+}
+
+func (c *Client) RemoveBubble(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, c.sim+"/bubbles/"+url.PathEscape(id), nil, nil, nil)
+}
+
+// Relink moves bubble id in the chain to just after the bubble after.
+func (c *Client) Relink(ctx context.Context, id, after string) (BubbleInfo, error) {
+	var b BubbleInfo
+	body := struct {
+		After string `json:"after"`
+	}{after}
+	return b, c.do(ctx, http.MethodPost, c.sim+"/bubbles/"+url.PathEscape(id)+"/link", nil, body, &b)
+}
+
+func (c *Client) History(ctx context.Context, id string) ([]BubbleSample, error) {
+	var h []BubbleSample
+	return h, c.do(ctx, http.MethodGet, c.sim+"/bubbles/"+url.PathEscape(id)+"/history", nil, nil, &h)
+}
+
+// --- clock ---
+
+func (c *Client) Clock(ctx context.Context) (ClockStatus, error) {
+	var st ClockStatus
+	return st, c.do(ctx, http.MethodGet, c.sim+"/clock", nil, nil, &st)
+}
+
+func (c *Client) SetClock(ctx context.Context, u ClockUpdate) (ClockStatus, error) {
+	var st ClockStatus
+	return st, c.do(ctx, http.MethodPost, c.sim+"/clock", nil, u, &st)
+}
+
+// --- hosted simulations ---
+
+func (c *Client) Sims(ctx context.Context) ([]SimInfo, error) {
+	var out []SimInfo
+	return out, c.do(ctx, http.MethodGet, "/sims", nil, nil, &out)
+}
+
+// CreateSim hosts a new simulation; use Sim(info.ID) to drive it.
+func (c *Client) CreateSim(ctx context.Context, req CreateRequest) (SimInfo, error) {
+	var info SimInfo
+	return info, c.do(ctx, http.MethodPost, "/sims", nil, req, &info)
+}
+
+func (c *Client) DeleteSim(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/sims/"+url.PathEscape(id), nil, nil, nil)
+}
@@ -0,0 +1,424 @@
+package tag
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RickF71/tag-go/internal/tag"
+)
+
+// newServer serves a fresh simulation the way tagd does: the unversioned
+// routes, hosted simulations, and /api/v1 on top. wrap, if not nil, sits in
+// front of the mux.
+func newServer(t *testing.T, wrap func(http.Handler) http.Handler) (*Client, *tag.Simulation) {
+	t.Helper()
+	sim := tag.NewSimulation()
+	mux := http.NewServeMux()
+	tag.RegisterRoutes(mux, sim)
+	host := tag.NewHost(tag.HostLimits{})
+	host.Register(mux, sim)
+	tag.RegisterV1(mux)
+	var h http.Handler = mux
+	if wrap != nil {
+		h = wrap(mux)
+	}
+	srv := httptest.NewServer(h)
+	t.Cleanup(func() {
+		srv.Close()
+		host.Close()
+		sim.Clock().Close()
+	})
+	return NewClient(srv.URL), sim
+}
+
+func ptr(v float64) *float64 { return &v }
+
+func TestStepAndReset(t *testing.T) {
+	c, _ := newServer(t, nil)
+	ctx := context.Background()
+	for want := 1; want <= 3; want++ {
+		st, err := c.Step(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Step != want || st.Schema != SchemaVersion {
+			t.Fatalf("step %d: got step %d schema %d", want, st.Step, st.Schema)
+		}
+	}
+	st, err := c.Reset(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Step != 0 {
+		t.Fatalf("reset left step %d", st.Step)
+	}
+	if st, err = c.State(ctx); err != nil || st.Step != 0 {
+		t.Fatalf("state after reset: step %d, %v", st.Step, err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	c, _ := newServer(t, nil)
+	ctx := context.Background()
+	sum, err := c.Run(ctx, RunRequest{Steps: 25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Steps != 25 || sum.FromStep != 0 || sum.ToStep != 25 || sum.Reason != "max_steps" {
+		t.Fatalf("got %+v", sum)
+	}
+	if _, err := c.Run(ctx, RunRequest{Until: []string{"sometime"}}); err == nil {
+		t.Fatal("unknown condition accepted")
+	}
+}
+
+func TestParams(t *testing.T) {
+	c, _ := newServer(t, nil)
+	ctx := context.Background()
+	p, err := c.Params(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := c.SetParams(ctx, ParamsPatch{Viscosity: ptr(0.1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p2.Viscosity != 0.1 || p2.Limit != p.Limit || p2.Dt != p.Dt {
+		t.Fatalf("patch changed more than viscosity: %+v -> %+v", p, p2)
+	}
+
+	_, err = c.SetParams(ctx, ParamsPatch{Dt: ptr(-1)})
+	var ae *APIError
+	if !errors.As(err, &ae) || ae.Status != http.StatusBadRequest || ae.Field != "dt" {
+		t.Fatalf("bad dt: got %v", err)
+	}
+	if p3, _ := c.Params(ctx); p3 != p2 {
+		t.Fatalf("rejected patch applied: %+v", p3)
+	}
+}
+
+func TestReceipts(t *testing.T) {
+	c, _ := newServer(t, nil)
+	ctx := context.Background()
+	if _, err := c.Run(ctx, RunRequest{Steps: 40}); err != nil {
+		t.Fatal(err)
+	}
+
+	var all []Receipt
+	q := ReceiptQuery{Limit: 7}
+	for {
+		p, err := c.Receipts(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Receipts) > q.Limit {
+			t.Fatalf("page of %d receipts, limit %d", len(p.Receipts), q.Limit)
+		}
+		all = append(all, p.Receipts...)
+		if p.Next == 0 {
+			break
+		}
+		q.Cursor = p.Next
+	}
+	if len(all) == 0 {
+		t.Fatal("no receipts after 40 steps")
+	}
+	for i := 1; i < len(all); i++ {
+		if all[i].ID <= all[i-1].ID {
+			t.Fatalf("receipt %d follows %d", all[i].ID, all[i-1].ID)
+		}
+	}
+
+	exported, _, err := c.ExportReceipts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exported) != len(all) {
+		t.Fatalf("export has %d receipts, pages %d", len(exported), len(all))
+	}
+
+	typ := all[0].Type
+	p, err := c.Receipts(ctx, ReceiptQuery{Types: []ReceiptType{typ}, Limit: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range p.Receipts {
+		if r.Type != typ {
+			t.Fatalf("filter on %s returned %s", typ, r.Type)
+		}
+	}
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	c, _ := newServer(t, nil)
+	ctx := context.Background()
+	if _, err := c.Run(ctx, RunRequest{Steps: 10}); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := c.Checkpoint(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Step != 10 {
+		t.Fatalf("checkpoint at step %d", cp.Step)
+	}
+	before, err := c.Bubbles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Run(ctx, RunRequest{Steps: 5}); err != nil {
+		t.Fatal(err)
+	}
+	st, err := c.Restore(ctx, cp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Step != 10 {
+		t.Fatalf("restored to step %d", st.Step)
+	}
+	after, err := c.Bubbles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) {
+		t.Fatalf("restored %d bubbles, checkpoint had %d", len(after), len(before))
+	}
+	for i := range before {
+		if after[i].ID != before[i].ID || after[i].State != before[i].State {
+			t.Fatalf("bubble %d: restored %+v, checkpoint had %+v", i, after[i], before[i])
+		}
+	}
+
+	// a broken checkpoint is refused and leaves the simulation alone
+	cp.Root = len(cp.Totes)
+	if _, err := c.Restore(ctx, cp); err == nil {
+		t.Fatal("checkpoint with a missing root restored")
+	}
+	if st, _ := c.State(ctx); st.Step != 10 {
+		t.Fatalf("failed restore moved the simulation to step %d", st.Step)
+	}
+}
+
+func TestTopology(t *testing.T) {
+	c, _ := newServer(t, nil)
+	ctx := context.Background()
+	ids := func() string {
+		bs, err := c.Bubbles(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s []string
+		for _, b := range bs {
+			s = append(s, b.ID)
+		}
+		return strings.Join(s, ",")
+	}
+	if got := ids(); got != "A,B,C,D" {
+		t.Fatalf("default chain %s", got)
+	}
+
+	b, err := c.AddBubble(ctx, BubbleSpec{ID: "X", After: "B", State: 1, Demand: 1.2, Tolerance: 0.05})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Parent != "B" || b.Child != "C" {
+		t.Fatalf("X linked %s -> X -> %s", b.Parent, b.Child)
+	}
+	if got := ids(); got != "A,B,X,C,D" {
+		t.Fatalf("after add: %s", got)
+	}
+
+	if b, err = c.UpdateBubble(ctx, "X", BubblePatch{Demand: ptr(2)}); err != nil || b.Demand != 2 || b.State != 1 {
+		t.Fatalf("update: %+v, %v", b, err)
+	}
+	if _, err = c.Relink(ctx, "X", "C"); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(); got != "A,B,C,X,D" {
+		t.Fatalf("after relink: %s", got)
+	}
+
+	if _, err := c.Step(ctx); err != nil {
+		t.Fatal(err)
+	}
+	h, err := c.History(ctx, "X")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h) == 0 || h[len(h)-1].Step != 1 {
+		t.Fatalf("history %+v", h)
+	}
+
+	if err := c.RemoveBubble(ctx, "X"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Bubble(ctx, "X"); !IsNotFound(err) {
+		t.Fatalf("removed bubble: got %v, want not found", err)
+	}
+	if got := ids(); got != "A,B,C,D" {
+		t.Fatalf("after remove: %s", got)
+	}
+}
+
+func TestHostedSim(t *testing.T) {
+	c, _ := newServer(t, nil)
+	ctx := context.Background()
+	info, err := c.CreateSim(ctx, CreateRequest{ID: "lab", Scenario: &Scenario{Steps: 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ID != "lab" || info.Step != 3 {
+		t.Fatalf("created %+v", info)
+	}
+	lab := c.Sim("lab")
+	if st, err := lab.Step(ctx); err != nil || st.Step != 4 {
+		t.Fatalf("hosted step: %d, %v", st.Step, err)
+	}
+	if st, _ := c.State(ctx); st.Step != 0 {
+		t.Fatalf("hosted step moved the main simulation to %d", st.Step)
+	}
+	if err := c.DeleteSim(ctx, "lab"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lab.State(ctx); !IsNotFound(err) {
+		t.Fatalf("deleted sim: got %v, want not found", err)
+	}
+}
+
+// dropper ends the first /stream response after its first event, as a
+// server restart or a proxy timeout would, and records the Last-Event-ID of
+// every stream request.
+type dropper struct {
+	next http.Handler
+
+	mu      sync.Mutex
+	dropped bool
+	resumes []string
+}
+
+func (d *dropper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasSuffix(r.URL.Path, "/stream") {
+		d.next.ServeHTTP(w, r)
+		return
+	}
+	d.mu.Lock()
+	d.resumes = append(d.resumes, r.Header.Get("Last-Event-ID"))
+	drop := !d.dropped
+	d.dropped = true
+	d.mu.Unlock()
+	if !drop {
+		d.next.ServeHTTP(w, r)
+		return
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	d.next.ServeHTTP(&cutWriter{ResponseWriter: w, cut: cancel}, r.WithContext(ctx))
+}
+
+func (d *dropper) lastEventIDs() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.resumes...)
+}
+
+// cutWriter cancels its request once the handler has written an event.
+type cutWriter struct {
+	http.ResponseWriter
+	cut context.CancelFunc
+}
+
+func (w *cutWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.cut()
+	return n, err
+}
+
+func (w *cutWriter) Flush() { w.ResponseWriter.(http.Flusher).Flush() }
+
+func TestSubscribeResumesAfterDrop(t *testing.T) {
+	var d *dropper
+	c, sim := newServer(t, func(h http.Handler) http.Handler {
+		d = &dropper{next: h}
+		return d
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// step by hand at a steady pace, with the clock paused, so every frame
+	// has news and the test knows what the ledger holds
+	paused := true
+	if _, err := c.SetClock(ctx, ClockUpdate{Paused: &paused}); err != nil {
+		t.Fatal(err)
+	}
+	stepping, stopStepping := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for stepping.Err() == nil {
+			sim.Step()
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	var frames []StreamFrame
+	errStop := errors.New("enough")
+	err := c.Subscribe(ctx, StreamOptions{}, func(fr StreamFrame) error {
+		frames = append(frames, fr)
+		if len(d.lastEventIDs()) >= 2 && len(frames) >= 4 {
+			return errStop
+		}
+		return nil
+	})
+	stopStepping()
+	wg.Wait()
+	if !errors.Is(err, errStop) {
+		t.Fatalf("Subscribe ended with %v", err)
+	}
+
+	ids := d.lastEventIDs()
+	if ids[0] != "" {
+		t.Fatalf("first connection sent Last-Event-ID %q", ids[0])
+	}
+	if want := strconv.FormatUint(frames[0].Cursor, 10); ids[1] != want {
+		t.Fatalf("reconnected with Last-Event-ID %q, want %q", ids[1], want)
+	}
+
+	seen := map[uint64]bool{}
+	for i, fr := range frames {
+		if fr.Truncated {
+			t.Fatalf("frame %d truncated", i)
+		}
+		if i > 0 && fr.Cursor < frames[i-1].Cursor {
+			t.Fatalf("cursor went back from %d to %d", frames[i-1].Cursor, fr.Cursor)
+		}
+		for _, r := range fr.Receipts {
+			if seen[r.ID] {
+				t.Fatalf("receipt %d delivered twice", r.ID)
+			}
+			seen[r.ID] = true
+		}
+	}
+	// nothing the server recorded while the client was away went missing
+	ledger, _, err := c.ExportReceipts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := frames[len(frames)-1].Cursor
+	if last <= frames[0].Cursor {
+		t.Fatalf("no receipts after the drop (cursor %d)", last)
+	}
+	for _, r := range ledger[frames[0].Cursor:last] {
+		if !seen[r.ID] {
+			t.Fatalf("receipt %d (step %d) lost across the reconnect", r.ID, r.Step)
+		}
+	}
+}
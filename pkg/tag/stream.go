@@ -0,0 +1,132 @@
+package tag
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StreamOptions narrows and positions a subscription.
+type StreamOptions struct {
+	Types    []ReceiptType // only receipts of these types; empty means all
+	Subjects []string      // only receipts about these subjects; empty means all
+	Frames   bool          // also deliver drawable Frames
+	Cursor   uint64        // resume after this cursor; 0 starts now (or at SinceStep)
+	// SinceStep replays receipts from this step when Cursor is 0 and it is > 0.
+	SinceStep int
+}
+
+// Reconnect backoff bounds for Subscribe.
+const (
+	minBackoff = 250 * time.Millisecond
+	maxBackoff = 10 * time.Second
+)
+
+// Subscribe calls fn for every frame of the server-sent event stream until
+// ctx is done or fn returns an error. A dropped connection is reopened with
+// the last cursor seen, so no receipts are lost while the server still
+// retains them. Errors the server answers with, other than 429 and 5xx,
+// end the subscription.
+func (c *Client) Subscribe(ctx context.Context, opts StreamOptions, fn func(StreamFrame) error) error {
+	q := url.Values{}
+	if len(opts.Types) > 0 {
+		ts := make([]string, len(opts.Types))
+		for i, t := range opts.Types {
+			ts[i] = string(t)
+		}
+		q.Set("types", strings.Join(ts, ","))
+	}
+	if len(opts.Subjects) > 0 {
+		q.Set("subject", strings.Join(opts.Subjects, ","))
+	}
+	if opts.Frames {
+		q.Set("frame", "1")
+	}
+	if opts.Cursor == 0 && opts.SinceStep > 0 {
+		q.Set("since_step", strconv.Itoa(opts.SinceStep))
+	}
+
+	cursor, backoff := opts.Cursor, minBackoff
+	for {
+		got, err := c.stream(ctx, q, cursor, func(fr StreamFrame) error {
+			cursor = fr.Cursor
+			return fn(fr)
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var ae *APIError
+		if errors.As(err, &ae) && ae.Status != http.StatusTooManyRequests && ae.Status < 500 {
+			return err
+		}
+		if err != nil && !errors.Is(err, errDropped) {
+			return err // fn's own error
+		}
+		if got {
+			backoff = minBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, maxBackoff)
+		if cursor > 0 {
+			q.Del("since_step") // Last-Event-ID takes over
+		}
+	}
+}
+
+// errDropped marks a connection lost or refused, which Subscribe retries.
+var errDropped = errors.New("stream dropped")
+
+// stream reads one connection's events. It reports whether any frame
+// arrived; transport failures come back wrapped in errDropped.
+func (c *Client) stream(ctx context.Context, q url.Values, cursor uint64, fn func(StreamFrame) error) (bool, error) {
+	h := http.Header{"Accept": {"text/event-stream"}}
+	if cursor > 0 {
+		h.Set("Last-Event-ID", strconv.FormatUint(cursor, 10))
+	}
+	resp, err := c.send(ctx, http.MethodGet, c.sim+"/stream", q, nil, h)
+	if err != nil {
+		var ae *APIError
+		if errors.As(err, &ae) {
+			return false, err
+		}
+		return false, errors.Join(errDropped, err)
+	}
+	defer resp.Body.Close()
+
+	got := false
+	var data []string
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 64<<20) // keyframes can be large
+	for sc.Scan() {
+		line := sc.Text()
+		if line != "" {
+			if v, ok := strings.CutPrefix(line, "data:"); ok {
+				data = append(data, strings.TrimPrefix(v, " "))
+			}
+			continue // id: repeats the frame's cursor; other fields are unused
+		}
+		if len(data) == 0 {
+			continue
+		}
+		var fr StreamFrame
+		if err := json.Unmarshal([]byte(strings.Join(data, "\n")), &fr); err != nil {
+			return got, errors.Join(errDropped, err)
+		}
+		data = data[:0]
+		got = true
+		if err := fn(fr); err != nil {
+			return got, err
+		}
+	}
+	return got, errors.Join(errDropped, sc.Err())
+}
@@ -0,0 +1,33 @@
+package tag
+
+import "github.com/RickF71/tag-go/internal/tag"
+
+// The wire types are the server's own, so client and tagd cannot drift.
+type (
+	SimState      = tag.SimState
+	Frame         = tag.Frame
+	Bubble        = tag.Bubble
+	Params        = tag.Params
+	ParamsPatch   = tag.ParamsPatch
+	RunRequest    = tag.RunRequest
+	RunSummary    = tag.RunSummary
+	Receipt       = tag.Receipt
+	ReceiptType   = tag.ReceiptType
+	Page          = tag.Page
+	Observation   = tag.Observation
+	Checkpoint    = tag.Checkpoint
+	BubbleInfo    = tag.BubbleInfo
+	BubbleSpec    = tag.BubbleSpec
+	BubblePatch   = tag.BubblePatch
+	BubbleSample  = tag.BubbleSample
+	ClockStatus   = tag.ClockStatus
+	ClockUpdate   = tag.ClockUpdate
+	StreamFrame   = tag.StreamFrame
+	SimInfo       = tag.SimInfo
+	Scenario      = tag.Scenario
+	CreateRequest = tag.CreateRequest
+	APIError      = tag.APIError
+)
+
+// SchemaVersion is the SimState and Frame schema this client understands.
+const SchemaVersion = tag.SchemaVersion
@@ -0,0 +1,7 @@
+// Package web holds the observatory pages tagd serves, compiled into the binary.
+package web
+
+import "embed"
+
+//go:embed *.html
+var Files embed.FS